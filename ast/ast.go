@@ -2,6 +2,7 @@ package ast
 
 import (
 	"bytes"
+	"fmt"
 	"monkey/token"
 	"strings"
 )
@@ -9,6 +10,7 @@ import (
 type Node interface {
     TokenLiteral() string
     String() string
+    Pos() token.Position // where the node starts in the source
 }
 
 type Statement interface {
@@ -33,6 +35,13 @@ func (p *Program) TokenLiteral() string {
     }
 }
 
+func (p *Program) Pos() token.Position {
+    if len(p.Statements) > 0 {
+        return p.Statements[0].Pos()
+    }
+    return token.Position{}
+}
+
 func (p *Program) String() string {
     var out bytes.Buffer
 
@@ -43,16 +52,51 @@ func (p *Program) String() string {
     return out.String()
 }
 
+// Exports are the names bound by the program's export let statements
+func (p *Program) Exports() []*Identifier {
+    names := []*Identifier{}
+
+    for _, s := range p.Statements {
+        if let, ok := s.(*LetStatement); ok && let.Exported {
+            names = append(names, let.Names()...)
+        }
+    }
+
+    return names
+}
+
 type LetStatement struct {
     Token token.Token
     Name *Identifier
+    Pattern Pattern // set instead of Name for let [a, b] = ... and let {a, b} = ...
     Value Expression
+    Exported bool // export let ..., only allowed at the top level
+}
+
+// Names are the identifiers the statement binds
+func (ls *LetStatement) Names() []*Identifier {
+    switch pattern := ls.Pattern.(type) {
+    case *ArrayPattern:
+        names := append([]*Identifier{}, pattern.Elements...)
+        if pattern.Rest != nil {
+            names = append(names, pattern.Rest)
+        }
+        return names
+    case *HashPattern:
+        return pattern.Keys
+    }
+
+    return []*Identifier{ls.Name}
 }
 
 func (ls *LetStatement) TokenLiteral() string {
     return ls.Token.Literal
 }
 
+func (ls *LetStatement) Pos() token.Position {
+    return ls.Token.Pos
+}
+
 func (ls *LetStatement) statementNode() {
 
 }
@@ -60,8 +104,15 @@ func (ls *LetStatement) statementNode() {
 func (ls *LetStatement) String() string {
     var out  bytes.Buffer
 
+    if ls.Exported {
+        out.WriteString("export ")
+    }
     out.WriteString(ls.TokenLiteral() + " ")
-    out.WriteString(ls.Name.String())
+    if ls.Pattern != nil {
+        out.WriteString(ls.Pattern.String())
+    } else {
+        out.WriteString(ls.Name.String())
+    }
     out.WriteString(" = ")
 
     if ls.Value != nil {
@@ -74,6 +125,69 @@ func (ls *LetStatement) String() string {
 }
 
 
+// Pattern is the left side of a destructuring let
+type Pattern interface {
+    Node
+    patternNode()
+}
+
+// ArrayPattern is [a, b, ...rest], Rest is nil when there's no ...
+type ArrayPattern struct {
+    Token token.Token
+    Elements []*Identifier
+    Rest *Identifier
+}
+
+func (ap *ArrayPattern) TokenLiteral() string {
+    return ap.Token.Literal
+}
+
+func (ap *ArrayPattern) Pos() token.Position {
+    return ap.Token.Pos
+}
+
+func (ap *ArrayPattern) patternNode() {
+
+}
+
+func (ap *ArrayPattern) String() string {
+    names := []string{}
+    for _, el := range ap.Elements {
+        names = append(names, el.String())
+    }
+    if ap.Rest != nil {
+        names = append(names, "..." + ap.Rest.String())
+    }
+
+    return "[" + strings.Join(names, ", ") + "]"
+}
+
+// HashPattern is {name, age}, every name is looked up as a string key
+type HashPattern struct {
+    Token token.Token
+    Keys []*Identifier
+}
+
+func (hp *HashPattern) TokenLiteral() string {
+    return hp.Token.Literal
+}
+
+func (hp *HashPattern) Pos() token.Position {
+    return hp.Token.Pos
+}
+
+func (hp *HashPattern) patternNode() {
+
+}
+
+func (hp *HashPattern) String() string {
+    names := []string{}
+    for _, key := range hp.Keys {
+        names = append(names, key.String())
+    }
+
+    return "{" + strings.Join(names, ", ") + "}"
+}
 
 type ReturnStatement struct {
     Token token.Token
@@ -84,6 +198,10 @@ func (rs *ReturnStatement) TokenLiteral() string {
     return rs.Token.Literal
 }
 
+func (rs *ReturnStatement) Pos() token.Position {
+    return rs.Token.Pos
+}
+
 func (rs *ReturnStatement) statementNode() {
     
 }
@@ -102,6 +220,170 @@ func (rs *ReturnStatement) String() string {
     return out.String()
 }
 
+type WhileStatement struct {
+    Token token.Token
+    Condition Expression
+    Body *BlockStatement
+}
+
+func (ws *WhileStatement) TokenLiteral() string {
+    return ws.Token.Literal
+}
+
+func (ws *WhileStatement) Pos() token.Position {
+    return ws.Token.Pos
+}
+
+func (ws *WhileStatement) statementNode() {
+
+}
+
+func (ws *WhileStatement) String() string {
+    var out bytes.Buffer
+
+    out.WriteString("while")
+    out.WriteString(ws.Condition.String())
+    out.WriteString(" ")
+    out.WriteString(ws.Body.String())
+
+    return out.String()
+}
+
+type ForStatement struct {
+    Token token.Token
+    Key *Identifier // nil unless the loop has two variables
+    Value *Identifier
+    Iterable Expression
+    Body *BlockStatement
+}
+
+func (fs *ForStatement) TokenLiteral() string {
+    return fs.Token.Literal
+}
+
+func (fs *ForStatement) Pos() token.Position {
+    return fs.Token.Pos
+}
+
+func (fs *ForStatement) statementNode() {
+
+}
+
+func (fs *ForStatement) String() string {
+    var out bytes.Buffer
+
+    out.WriteString("for (")
+    if fs.Key != nil {
+        out.WriteString(fs.Key.String() + ", ")
+    }
+    out.WriteString(fs.Value.String())
+    out.WriteString(" in ")
+    out.WriteString(fs.Iterable.String())
+    out.WriteString(") ")
+    out.WriteString(fs.Body.String())
+
+    return out.String()
+}
+
+// TryStatement is try { } catch (e) { } finally { }, Catch or Finally is nil when it's left out
+type TryStatement struct {
+    Token token.Token
+    Body *BlockStatement
+    CatchParam *Identifier
+    Catch *BlockStatement
+    Finally *BlockStatement
+}
+
+func (ts *TryStatement) TokenLiteral() string {
+    return ts.Token.Literal
+}
+
+func (ts *TryStatement) Pos() token.Position {
+    return ts.Token.Pos
+}
+
+func (ts *TryStatement) statementNode() {
+
+}
+
+func (ts *TryStatement) String() string {
+    var out bytes.Buffer
+
+    out.WriteString("try ")
+    out.WriteString(ts.Body.String())
+    if ts.Catch != nil {
+        out.WriteString(" catch (" + ts.CatchParam.String() + ") ")
+        out.WriteString(ts.Catch.String())
+    }
+    if ts.Finally != nil {
+        out.WriteString(" finally ")
+        out.WriteString(ts.Finally.String())
+    }
+
+    return out.String()
+}
+
+type ThrowStatement struct {
+    Token token.Token
+    Value Expression
+}
+
+func (ts *ThrowStatement) TokenLiteral() string {
+    return ts.Token.Literal
+}
+
+func (ts *ThrowStatement) Pos() token.Position {
+    return ts.Token.Pos
+}
+
+func (ts *ThrowStatement) statementNode() {
+
+}
+
+func (ts *ThrowStatement) String() string {
+    return "throw " + ts.Value.String() + ";"
+}
+
+type BreakStatement struct {
+    Token token.Token
+}
+
+func (bs *BreakStatement) TokenLiteral() string {
+    return bs.Token.Literal
+}
+
+func (bs *BreakStatement) Pos() token.Position {
+    return bs.Token.Pos
+}
+
+func (bs *BreakStatement) statementNode() {
+
+}
+
+func (bs *BreakStatement) String() string {
+    return bs.TokenLiteral() + ";"
+}
+
+type ContinueStatement struct {
+    Token token.Token
+}
+
+func (cs *ContinueStatement) TokenLiteral() string {
+    return cs.Token.Literal
+}
+
+func (cs *ContinueStatement) Pos() token.Position {
+    return cs.Token.Pos
+}
+
+func (cs *ContinueStatement) statementNode() {
+
+}
+
+func (cs *ContinueStatement) String() string {
+    return cs.TokenLiteral() + ";"
+}
+
 type ExpressionStatement struct {
     Token token.Token
     Expression Expression
@@ -111,6 +393,10 @@ func (es *ExpressionStatement) TokenLiteral() string {
     return es.Token.Literal
 }
 
+func (es *ExpressionStatement) Pos() token.Position {
+    return es.Token.Pos
+}
+
 func (es *ExpressionStatement) statementNode() {
 
 }
@@ -132,6 +418,10 @@ func (bs *BlockStatement) TokenLiteral() string {
     return bs.Token.Literal
 }
 
+func (bs *BlockStatement) Pos() token.Position {
+    return bs.Token.Pos
+}
+
 func (bs *BlockStatement) statementNode() {
     
 }
@@ -155,6 +445,10 @@ func (i *Identifier) TokenLiteral() string {
     return i.Token.Literal
 }
 
+func (i *Identifier) Pos() token.Position {
+    return i.Token.Pos
+}
+
 func (i *Identifier) expressionNode() {
 
 }
@@ -172,6 +466,10 @@ func (il *IntegerLiteral) TokenLiteral() string {
     return il.Token.Literal
 }
 
+func (il *IntegerLiteral) Pos() token.Position {
+    return il.Token.Pos
+}
+
 func (il *IntegerLiteral) expressionNode() {
 
 }
@@ -180,6 +478,27 @@ func (il *IntegerLiteral) String() string {
     return il.Token.Literal
 }
 
+type FloatLiteral struct {
+    Token token.Token
+    Value float64
+}
+
+func (fl *FloatLiteral) TokenLiteral() string {
+    return fl.Token.Literal
+}
+
+func (fl *FloatLiteral) Pos() token.Position {
+    return fl.Token.Pos
+}
+
+func (fl *FloatLiteral) expressionNode() {
+
+}
+
+func (fl *FloatLiteral) String() string {
+    return fl.Token.Literal
+}
+
 type StringLiteral struct {
     Token token.Token
     Value string
@@ -189,6 +508,10 @@ func (sl *StringLiteral) TokenLiteral() string {
     return sl.Token.Literal
 }
 
+func (sl *StringLiteral) Pos() token.Position {
+    return sl.Token.Pos
+}
+
 func (sl *StringLiteral) expressionNode() {
 
 }
@@ -213,6 +536,10 @@ func (pe *PrefixExpression) TokenLiteral() string {
     return pe.Token.Literal
 }
 
+func (pe *PrefixExpression) Pos() token.Position {
+    return pe.Token.Pos
+}
+
 func (pe *PrefixExpression) expressionNode() {
 
 }
@@ -239,6 +566,10 @@ func (ie *InfixExpression) TokenLiteral() string {
     return ie.Token.Literal
 }
 
+func (ie *InfixExpression) Pos() token.Position {
+    return ie.Token.Pos
+}
+
 func (ie *InfixExpression) expressionNode() {
 
 }
@@ -255,6 +586,29 @@ func (ie *InfixExpression) String() string {
     return out.String()
 }
 
+// x = value or collection[index] = value
+type AssignExpression struct {
+    Token token.Token // the = token
+    Target Expression // *Identifier or *IndexExpression
+    Value Expression
+}
+
+func (ae *AssignExpression) TokenLiteral() string {
+    return ae.Token.Literal
+}
+
+func (ae *AssignExpression) Pos() token.Position {
+    return ae.Target.Pos()
+}
+
+func (ae *AssignExpression) expressionNode() {
+
+}
+
+func (ae *AssignExpression) String() string {
+    return ae.Target.String() + " = " + ae.Value.String()
+}
+
 type Boolean struct {
     Token token.Token
     Value bool
@@ -264,6 +618,10 @@ func (b *Boolean) TokenLiteral() string {
     return b.Token.Literal
 }
 
+func (b *Boolean) Pos() token.Position {
+    return b.Token.Pos
+}
+
 func (b *Boolean) expressionNode() {
 
 }
@@ -284,6 +642,10 @@ func (ie *IfExpression) TokenLiteral() string {
     return ie.Token.Literal
 }
 
+func (ie *IfExpression) Pos() token.Position {
+    return ie.Token.Pos
+}
+
 func (ie *IfExpression) expressionNode() {
 
 }
@@ -312,16 +674,222 @@ func (ie *IfExpression) String() string {
     return out.String()
 }
 
+// MatchExpression is match (subject) { pattern if guard => value, ... }, the first arm that matches
+// gives the value
+type MatchExpression struct {
+    Token token.Token
+    Subject Expression
+    Arms []*MatchArm
+}
+
+// MatchArm is one pattern => value of a match, Guard is nil when there's no if
+type MatchArm struct {
+    Pattern MatchPattern
+    Guard Expression
+    Value Expression
+}
+
+func (me *MatchExpression) TokenLiteral() string {
+    return me.Token.Literal
+}
+
+func (me *MatchExpression) Pos() token.Position {
+    return me.Token.Pos
+}
+
+func (me *MatchExpression) expressionNode() {
+
+}
+
+func (me *MatchExpression) String() string {
+    arms := []string{}
+    for _, arm := range me.Arms {
+        str := arm.Pattern.String()
+        if arm.Guard != nil {
+            str += " if " + arm.Guard.String()
+        }
+        arms = append(arms, str + " => " + arm.Value.String())
+    }
+
+    return "match (" + me.Subject.String() + ") { " + strings.Join(arms, ", ") + " }"
+}
+
+// MatchPattern is what the arms of a match compare the subject against
+type MatchPattern interface {
+    Node
+    matchPatternNode()
+}
+
+// LiteralPattern is 1, -2.5, "a" or true, Value is the literal (or a minus in front of a number)
+type LiteralPattern struct {
+    Token token.Token
+    Value Expression
+}
+
+func (lp *LiteralPattern) TokenLiteral() string {
+    return lp.Token.Literal
+}
+
+func (lp *LiteralPattern) Pos() token.Position {
+    return lp.Token.Pos
+}
+
+func (lp *LiteralPattern) matchPatternNode() {
+
+}
+
+func (lp *LiteralPattern) String() string {
+    return lp.Value.String()
+}
+
+// WildcardPattern is _, it matches anything and binds nothing
+type WildcardPattern struct {
+    Token token.Token
+}
+
+func (wp *WildcardPattern) TokenLiteral() string {
+    return wp.Token.Literal
+}
+
+func (wp *WildcardPattern) Pos() token.Position {
+    return wp.Token.Pos
+}
+
+func (wp *WildcardPattern) matchPatternNode() {
+
+}
+
+func (wp *WildcardPattern) String() string {
+    return "_"
+}
+
+// BindingPattern is a name, it matches anything and binds it to the name
+type BindingPattern struct {
+    Name *Identifier
+}
+
+func (bp *BindingPattern) TokenLiteral() string {
+    return bp.Name.TokenLiteral()
+}
+
+func (bp *BindingPattern) Pos() token.Position {
+    return bp.Name.Pos()
+}
+
+func (bp *BindingPattern) matchPatternNode() {
+
+}
+
+func (bp *BindingPattern) String() string {
+    return bp.Name.String()
+}
+
+// ArrayMatchPattern is [p1, p2, ...rest]. without a rest the array must have exactly as many
+// elements as there are patterns, Rest is nil then
+type ArrayMatchPattern struct {
+    Token token.Token
+    Elements []MatchPattern
+    Rest *Identifier
+}
+
+func (ap *ArrayMatchPattern) TokenLiteral() string {
+    return ap.Token.Literal
+}
+
+func (ap *ArrayMatchPattern) Pos() token.Position {
+    return ap.Token.Pos
+}
+
+func (ap *ArrayMatchPattern) matchPatternNode() {
+
+}
+
+func (ap *ArrayMatchPattern) String() string {
+    elements := []string{}
+    for _, el := range ap.Elements {
+        elements = append(elements, el.String())
+    }
+    if ap.Rest != nil {
+        elements = append(elements, "..." + ap.Rest.String())
+    }
+
+    return "[" + strings.Join(elements, ", ") + "]"
+}
+
+// HashMatchPattern is {"key": pattern, name}, every key must be there and its value match. other
+// keys are allowed. a lone name is short for "name": name
+type HashMatchPattern struct {
+    Token token.Token
+    Keys []Expression // literals, in the order they were written
+    Values []MatchPattern
+}
+
+func (hp *HashMatchPattern) TokenLiteral() string {
+    return hp.Token.Literal
+}
+
+func (hp *HashMatchPattern) Pos() token.Position {
+    return hp.Token.Pos
+}
+
+func (hp *HashMatchPattern) matchPatternNode() {
+
+}
+
+func (hp *HashMatchPattern) String() string {
+    pairs := []string{}
+    for i, key := range hp.Keys {
+        pairs = append(pairs, key.String() + ": " + hp.Values[i].String())
+    }
+
+    return "{" + strings.Join(pairs, ", ") + "}"
+}
+
 type FunctionLiteral struct {
     Token token.Token
     Parameters []*Identifier
+    Defaults []Expression // one per parameter, nil for the ones without a default
+    Rest *Identifier // the ...rest parameter, nil if there's none
     Body *BlockStatement
+    Name string // set when the function is bound by a let statement
+}
+
+// HasDefaults reports whether any parameter has a default value
+func (fl *FunctionLiteral) HasDefaults() bool {
+    for _, d := range fl.Defaults {
+        if d != nil {
+            return true
+        }
+    }
+    return false
+}
+
+// ParamsString is the parameter list as written, without the parentheses
+func (fl *FunctionLiteral) ParamsString() string {
+    params := []string{}
+
+    for i, p := range fl.Parameters {
+        if i < len(fl.Defaults) && fl.Defaults[i] != nil {
+            params = append(params, p.String() + " = " + fl.Defaults[i].String())
+        } else {
+            params = append(params, p.String())
+        }
+    }
+    if fl.Rest != nil {
+        params = append(params, "..." + fl.Rest.String())
+    }
+
+    return strings.Join(params, ", ")
 }
 
 func (fl *FunctionLiteral) TokenLiteral() string {
     return fl.Token.Literal
 }
 
+func (fl *FunctionLiteral) Pos() token.Position {
+    return fl.Token.Pos
+}
+
 func (fl *FunctionLiteral) expressionNode() {
 
 }
@@ -329,15 +897,12 @@ func (fl *FunctionLiteral) expressionNode() {
 func (fl *FunctionLiteral) String() string {
     var out bytes.Buffer
 
-    params := []string{}
-
-    for _, p := range fl.Parameters {
-        params = append(params, p.String())
-    }
-
     out.WriteString("fn")
+    if fl.Name != "" {
+        out.WriteString(fmt.Sprintf("<%s>", fl.Name))
+    }
     out.WriteString("(")
-    out.WriteString(strings.Join(params, ", "))
+    out.WriteString(fl.ParamsString())
     out.WriteString(") ")
     out.WriteString(fl.Body.String())
 
@@ -354,6 +919,10 @@ func(ce *CallExpression) TokenLiteral() string {
     return ce.Token.Literal
 }
 
+func (ce *CallExpression) Pos() token.Position {
+    return ce.Token.Pos
+}
+
 func (ce *CallExpression) expressionNode() {
 
 }
@@ -374,6 +943,40 @@ func (ce *CallExpression) String() string {
     return out.String()
 }
 
+// "a ${x} b", Parts holds the text as *StringLiteral and the embedded expressions in order
+type InterpolatedString struct {
+    Token token.Token // the INTERP_START token
+    Parts []Expression
+}
+
+func (is *InterpolatedString) TokenLiteral() string {
+    return is.Token.Literal
+}
+
+func (is *InterpolatedString) Pos() token.Position {
+    return is.Token.Pos
+}
+
+func (is *InterpolatedString) expressionNode() {
+
+}
+
+func (is *InterpolatedString) String() string {
+    var out bytes.Buffer
+
+    out.WriteString("\"")
+    for _, part := range is.Parts {
+        if str, ok := part.(*StringLiteral); ok {
+            out.WriteString(str.Value)
+        } else {
+            out.WriteString("${" + part.String() + "}")
+        }
+    }
+    out.WriteString("\"")
+
+    return out.String()
+}
+
 type ArrayLiteral struct {
     Token token.Token
     Elements []Expression
@@ -383,6 +986,10 @@ func (al *ArrayLiteral) TokenLiteral() string {
     return al.Token.Literal
 }
 
+func (al *ArrayLiteral) Pos() token.Position {
+    return al.Token.Pos
+}
+
 func (al *ArrayLiteral) expressionNode() {
 
 }
@@ -412,6 +1019,10 @@ func (ie *IndexExpression) TokenLiteral() string {
     return ie.Token.Literal
 }
 
+func (ie *IndexExpression) Pos() token.Position {
+    return ie.Token.Pos
+}
+
 func (ie *IndexExpression) expressionNode() {
 
 }
@@ -419,6 +1030,10 @@ func (ie *IndexExpression) expressionNode() {
 func (ie *IndexExpression) String() string {
     var out bytes.Buffer
 
+    if ie.Token.Type == token.DOT { // m.name, the index is the name as a string
+        return "(" + ie.Left.String() + "." + ie.Index.TokenLiteral() + ")"
+    }
+
     out.WriteString("(")
     out.WriteString(ie.Left.String())
     out.WriteString("[")
@@ -428,6 +1043,28 @@ func (ie *IndexExpression) String() string {
     return out.String()
 }
 
+// ImportExpression is import "path", its value is the module's namespace
+type ImportExpression struct {
+    Token token.Token
+    Path string
+}
+
+func (ie *ImportExpression) TokenLiteral() string {
+    return ie.Token.Literal
+}
+
+func (ie *ImportExpression) Pos() token.Position {
+    return ie.Token.Pos
+}
+
+func (ie *ImportExpression) expressionNode() {
+
+}
+
+func (ie *ImportExpression) String() string {
+    return fmt.Sprintf("import %q", ie.Path)
+}
+
 type HashLiteral struct {
     Token token.Token
     Pairs map[Expression]Expression
@@ -437,6 +1074,10 @@ func (hl *HashLiteral) TokenLiteral() string {
     return hl.Token.Literal
 }
 
+func (hl *HashLiteral) Pos() token.Position {
+    return hl.Token.Pos
+}
+
 func (hl *HashLiteral) expressionNode() {
     
 }
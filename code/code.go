@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/binary"
 	"fmt"
+	"monkey/token"
 )
 
 type Instructions []byte
@@ -37,6 +38,8 @@ func (ins Instructions) instructionsFormat(def *Definition, operands []int) stri
         return def.Name
     case 1:
         return fmt.Sprintf("%s %d", def.Name, operands[0])
+    case 2:
+        return fmt.Sprintf("%s %d %d", def.Name, operands[0], operands[1])
     }
 
     return fmt.Sprintf("ERROR: unhandled operandCount for %s\n", def.Name)
@@ -72,6 +75,43 @@ const (
     OpCall
     OpReturn
     OpReturnValue
+    OpClosure
+    OpGetFree
+    OpGetBuiltin
+    OpCurrentClosure
+    OpIter
+    OpIterNext
+    OpSetIndex
+    OpJumpIfFalsy
+    OpJumpIfTruthy
+    OpLessEqual
+    OpMod
+    OpBitAnd
+    OpBitOr
+    OpBitXor
+    OpShiftLeft
+    OpShiftRight
+    OpBitNot
+    OpBuildString
+    OpUnpackArray
+    OpUnpackHash
+    OpJumpIfArg
+    OpImport
+    OpModule
+    OpTry
+    OpEndTry
+    OpThrow
+    OpRethrow
+    OpMatchLiteral
+    OpMatchArray
+    OpMatchHash
+    OpArrayRest
+    OpNoMatch
+    OpTailCall
+    OpCaptureLocal
+    OpCaptureFree
+    OpSetFree
+    OpBindLocal
 )
 
 type Definition struct {
@@ -106,6 +146,45 @@ var definitions = map[Opcode]*Definition{
     OpCall: {"OpCall", []int{1}},
     OpReturn: {"OpReturn", []int{}},
     OpReturnValue: {"OpReturnValue", []int{}},
+    OpClosure: {"OpClosure", []int{2, 1}}, // constant index of the function and number of free variables
+    OpGetFree: {"OpGetFree", []int{1}},
+    OpGetBuiltin: {"OpGetBuiltin", []int{1}}, // index into object.Builtins
+    OpCurrentClosure: {"OpCurrentClosure", []int{}},
+    OpIter: {"OpIter", []int{}},
+    OpIterNext: {"OpIterNext", []int{2, 1}}, // jump target once exhausted, number of loop variables
+    OpSetIndex: {"OpSetIndex", []int{}},
+    // these jump keeping the value on the stack and pop it otherwise, for && and ||
+    OpJumpIfFalsy: {"OpJumpIfFalsy", []int{2}},
+    OpJumpIfTruthy: {"OpJumpIfTruthy", []int{2}},
+    OpLessEqual: {"OpLessEqual", []int{}}, // >= is compiled to this with the operands swapped
+    OpMod: {"OpMod", []int{}},
+    OpBitAnd: {"OpBitAnd", []int{}},
+    OpBitOr: {"OpBitOr", []int{}},
+    OpBitXor: {"OpBitXor", []int{}},
+    OpShiftLeft: {"OpShiftLeft", []int{}},
+    OpShiftRight: {"OpShiftRight", []int{}},
+    OpBitNot: {"OpBitNot", []int{}},
+    OpBuildString: {"OpBuildString", []int{2}}, // number of parts to join
+    OpUnpackArray: {"OpUnpackArray", []int{2, 1}}, // number of elements, 1 if a rest array follows them
+    OpUnpackHash: {"OpUnpackHash", []int{2}}, // number of keys on the stack above the hash map
+    OpJumpIfArg: {"OpJumpIfArg", []int{2, 1}}, // jump position, parameter index. skips a default when the argument was passed
+    OpImport: {"OpImport", []int{2, 2}}, // global holding the module, jump position. skips running a module that already ran
+    OpModule: {"OpModule", []int{2, 2}}, // constant index of the path, number of name/value pairs of the exports
+    OpTry: {"OpTry", []int{2}}, // where to go on an error until the matching OpEndTry
+    OpEndTry: {"OpEndTry", []int{}},
+    OpThrow: {"OpThrow", []int{}},
+    OpRethrow: {"OpRethrow", []int{}}, // throws what the last catch got again, from where it was first raised
+    OpMatchLiteral: {"OpMatchLiteral", []int{}}, // pushes whether the value below the literal equals it
+    OpMatchArray: {"OpMatchArray", []int{2, 1}}, // number of elements, 1 if the pattern has a ...rest
+    OpMatchHash: {"OpMatchHash", []int{2}}, // number of keys on the stack above the value
+    OpArrayRest: {"OpArrayRest", []int{2}}, // pushes a new array of the elements from the operand on
+    OpNoMatch: {"OpNoMatch", []int{}},
+    OpTailCall: {"OpTailCall", []int{1}}, // number of arguments. like OpCall, but the callee takes over the caller's frame
+    // a captured local lives in a cell, the closure gets the cell and not a copy of the value
+    OpCaptureLocal: {"OpCaptureLocal", []int{1}}, // pushes the cell of the local, putting it in one first
+    OpCaptureFree: {"OpCaptureFree", []int{1}}, // pushes the free variable's cell for a closure inside the closure
+    OpSetFree: {"OpSetFree", []int{1}},
+    OpBindLocal: {"OpBindLocal", []int{1}}, // like OpSetLocal, but a new variable instead of a write to the old one's cell
 }
 
 func Lookup(op byte) (*Definition, error) {
@@ -174,3 +253,26 @@ func ReadUint16(ins Instructions) uint16 {
 func ReadUint8(ins Instructions) uint8 {
     return uint8(ins[0])
 }
+
+// SourcePos marks that the instructions starting at Offset were compiled from Pos
+type SourcePos struct {
+    Offset int
+    Pos token.Position
+}
+
+// PosTable is sorted by Offset and only has an entry where the position changes
+type PosTable []SourcePos
+
+// Lookup returns the source position of the instruction at the given offset
+func (t PosTable) Lookup(offset int) token.Position {
+    var pos token.Position
+
+    for _, entry := range t {
+        if entry.Offset > offset {
+            break
+        }
+        pos = entry.Pos
+    }
+
+    return pos
+}
@@ -1,6 +1,7 @@
 package code
 
 import (
+    "monkey/token"
     "testing"
 )
 
@@ -13,6 +14,7 @@ func TestMake(t *testing.T) {
         {OpConstant, []int{65534}, []byte{byte(OpConstant), 255, 254}},
         {OpAdd, []int{}, []byte{byte(OpAdd)}},
         {OpGetLocal, []int{255}, []byte{byte(OpGetLocal), 255}},
+        {OpClosure, []int{65534, 255}, []byte{byte(OpClosure), 255, 254, 255}},
     }
 
     for _, tt := range tests {
@@ -36,12 +38,14 @@ func TestInstructionsString(t *testing.T) {
         Make(OpGetLocal, 1),
         Make(OpConstant, 2),
         Make(OpConstant, 65535),
+        Make(OpClosure, 65535, 255),
     }
 
     expected := `0000 OpAdd
 0001 OpGetLocal 1
 0003 OpConstant 2
 0006 OpConstant 65535
+0009 OpClosure 65535 255
 `
 
     concatted := Instructions{}
@@ -62,6 +66,7 @@ func TestReadOperands(t *testing.T) {
     }{
         {OpConstant, []int{65535}, 2},
         {OpGetLocal, []int{255}, 1},
+        {OpClosure, []int{65535, 255}, 3},
     }
 
     for _, tt := range tests {
@@ -84,3 +89,30 @@ func TestReadOperands(t *testing.T) {
         }
     }
 }
+
+func TestPosTableLookup(t *testing.T) {
+    first := token.Position{Line: 1, Column: 1}
+    second := token.Position{Line: 2, Column: 5}
+
+    table := PosTable{
+        {Offset: 0, Pos: first},
+        {Offset: 4, Pos: second},
+    }
+
+    tests := []struct {
+        offset int
+        expected token.Position
+    }{
+        {0, first},
+        {3, first},
+        {4, second},
+        {100, second},
+    }
+
+    for _, tt := range tests {
+        pos := table.Lookup(tt.offset)
+        if pos != tt.expected {
+            t.Errorf("wrong position for offset %d. want=%+v, got=%+v", tt.offset, tt.expected, pos)
+        }
+    }
+}
@@ -4,7 +4,9 @@ import (
 	"fmt"
 	"monkey/ast"
 	"monkey/code"
+	"monkey/module"
 	"monkey/object"
+	"monkey/token"
 	"sort"
 )
 
@@ -16,12 +18,27 @@ type EmittedInstruction struct {
 type Bytecode struct {
     Instructions code.Instructions
     Constants []object.Object
+    Positions code.PosTable // source positions of the main instructions
 }
 
 type CompilationScope struct {
     instructions code.Instructions
     lastIns EmittedInstruction
     prevIns EmittedInstruction
+    positions code.PosTable
+    loops []*loopContext // the loops enclosing the code being compiled, innermost last
+    tries []*tryContext // the try blocks with a handler set up, innermost last
+    tailCalls map[*ast.CallExpression]bool // calls whose value the function returns right away, nil outside functions
+}
+
+type loopContext struct {
+    continuePos int // where continue jumps to
+    breakJumps []int // OpJmp instructions to patch with the end of the loop
+    tries int // how many try blocks were around the loop, break and continue leave the ones after them
+}
+
+type tryContext struct {
+    finally *ast.BlockStatement // nil if there's none
 }
 
 type Compiler struct {
@@ -29,6 +46,14 @@ type Compiler struct {
     symTable *SymTable
     scopes []CompilationScope
     scopeIndex int
+    pos token.Position // position of the node being compiled, recorded for every emitted instruction
+    importing module.Chain
+}
+
+// compiledModule is a module that's been compiled into a function running its top level
+type compiledModule struct {
+    fn int // constant index of the function
+    slot int // the global the namespace is kept in once the function ran
 }
 
 
@@ -39,9 +64,14 @@ func New_Compiler() *Compiler {
         prevIns: EmittedInstruction{},
     }
 
+    symTable := NewSymTable()
+    for i, b := range object.Builtins {
+        symTable.DefineBuiltin(i, b.Name)
+    }
+
     return &Compiler{
         Constants: []object.Object{},
-        symTable: NewSymTable(),
+        symTable: symTable,
         scopes: []CompilationScope{mainScope},
         scopeIndex: 0,
     }
@@ -63,6 +93,22 @@ func New_Compiler_With_States(constants []object.Object, symTable *SymTable) *Co
 }
 
 func (c *Compiler) Compile(node ast.Node) error {
+    if node == nil {
+        return nil
+    }
+
+    outerPos := c.pos
+    if pos := node.Pos(); pos.IsValid() {
+        c.pos = pos
+    }
+
+    err := c.compileNode(node)
+    c.pos = outerPos
+
+    return err
+}
+
+func (c *Compiler) compileNode(node ast.Node) error {
     switch node := node.(type) {
     case *ast.Program:
         for _, s := range node.Statements {
@@ -79,18 +125,126 @@ func (c *Compiler) Compile(node ast.Node) error {
             }
         }
     case *ast.LetStatement:
+        if node.Pattern != nil {
+            return c.compileDestructuring(node)
+        }
+
+        var symbol Symbol
+        _, isFunc := node.Value.(*ast.FunctionLiteral)
+
+        // functions are defined before their body is compiled so they can call themselves
+        if isFunc {
+            symbol = c.symTable.Define(node.Name.Value)
+        }
+
         err := c.Compile(node.Value)
         if err != nil {
             return err
         }
-        
-        symbol := c.symTable.Define(node.Name.Value)
-        if symbol.Scope == GlobalScope {
-            c.emit(code.OpSetGlobal, symbol.Index)
-        } else {
-            c.emit(code.OpSetLocal, symbol.Index)
+
+        if !isFunc {
+            symbol = c.symTable.Define(node.Name.Value)
+        }
+
+        c.storeSymbol(symbol)
+
+    case *ast.WhileStatement:
+        loopStart := len(c.currentInstructions())
+
+        err := c.Compile(node.Condition)
+        if err != nil {
+            return err
+        }
+
+        jneInsPos := c.emit(code.OpJNE, 6969)
+
+        loop := c.enterLoop(loopStart)
+        err = c.Compile(node.Body)
+        if err != nil {
+            return err
+        }
+        c.leaveLoop()
+
+        c.emit(code.OpJmp, loopStart)
+
+        loopEnd := len(c.currentInstructions())
+        c.changeOperand(jneInsPos, loopEnd)
+        for _, jmpPos := range loop.breakJumps {
+            c.changeOperand(jmpPos, loopEnd)
+        }
+    case *ast.ForStatement:
+        err := c.Compile(node.Iterable)
+        if err != nil {
+            return err
+        }
+
+        // the iterator lives in a slot of its own, the name can't clash with an identifier
+        iter := c.symTable.Define("@iter")
+        c.emit(code.OpIter)
+        c.storeSymbol(iter)
+
+        loopStart := len(c.currentInstructions())
+        c.loadSymbol(iter)
+
+        numVars := 1
+        if node.Key != nil {
+            numVars = 2
         }
+        nextInsPos := c.emit(code.OpIterNext, 6969, numVars)
 
+        // OpIterNext pushes the key below the value
+        c.storeSymbol(c.symTable.Define(node.Value.Value))
+        if node.Key != nil {
+            c.storeSymbol(c.symTable.Define(node.Key.Value))
+        }
+
+        loop := c.enterLoop(loopStart)
+        err = c.Compile(node.Body)
+        if err != nil {
+            return err
+        }
+        c.leaveLoop()
+
+        c.emit(code.OpJmp, loopStart)
+
+        loopEnd := len(c.currentInstructions())
+        c.changeOperand(nextInsPos, loopEnd, numVars)
+        for _, jmpPos := range loop.breakJumps {
+            c.changeOperand(jmpPos, loopEnd)
+        }
+    case *ast.BreakStatement:
+        loop := c.currentLoop()
+        if loop == nil {
+            return compileError(node, "break outside of a loop")
+        }
+
+        err := c.leaveTries(loop.tries)
+        if err != nil {
+            return err
+        }
+
+        loop.breakJumps = append(loop.breakJumps, c.emit(code.OpJmp, 6969))
+    case *ast.ContinueStatement:
+        loop := c.currentLoop()
+        if loop == nil {
+            return compileError(node, "continue outside of a loop")
+        }
+
+        err := c.leaveTries(loop.tries)
+        if err != nil {
+            return err
+        }
+
+        c.emit(code.OpJmp, loop.continuePos)
+    case *ast.TryStatement:
+        return c.compileTryStatement(node)
+    case *ast.ThrowStatement:
+        err := c.Compile(node.Value)
+        if err != nil {
+            return err
+        }
+
+        c.emit(code.OpThrow)
     case *ast.ExpressionStatement:
         err := c.Compile(node.Expression)
         if err != nil {
@@ -99,7 +253,11 @@ func (c *Compiler) Compile(node ast.Node) error {
         c.emit(code.OpPop)
 
     case *ast.InfixExpression:
-        if node.Operator == ">" {
+        if node.Operator == "&&" || node.Operator == "||" {
+            return c.compileLogicalExpression(node)
+        }
+
+        if node.Operator == ">" || node.Operator == ">=" {
             err := c.Compile(node.Right)
             if err != nil {
                 return err
@@ -110,7 +268,11 @@ func (c *Compiler) Compile(node ast.Node) error {
                 return err
             }
 
-            c.emit(code.OpLessThan)
+            if node.Operator == ">" {
+                c.emit(code.OpLessThan)
+            } else {
+                c.emit(code.OpLessEqual)
+            }
             return nil
         }
 
@@ -133,14 +295,28 @@ func (c *Compiler) Compile(node ast.Node) error {
             c.emit(code.OpMul)
         case "/":
             c.emit(code.OpDiv)
+        case "%":
+            c.emit(code.OpMod)
+        case "&":
+            c.emit(code.OpBitAnd)
+        case "|":
+            c.emit(code.OpBitOr)
+        case "^":
+            c.emit(code.OpBitXor)
+        case "<<":
+            c.emit(code.OpShiftLeft)
+        case ">>":
+            c.emit(code.OpShiftRight)
         case "<":
             c.emit(code.OpLessThan)
+        case "<=":
+            c.emit(code.OpLessEqual)
         case "==":
             c.emit(code.OpEqual)
         case "!=":
             c.emit(code.OpNotEqual)
         default:
-            return fmt.Errorf("unknown operator: %s", node.Operator)
+            return compileError(node, "unknown operator: %s", node.Operator)
         }
     case *ast.PrefixExpression:
         err := c.Compile(node.Right)
@@ -153,75 +329,81 @@ func (c *Compiler) Compile(node ast.Node) error {
             c.emit(code.OpBang)
         case "-":
             c.emit(code.OpMinus)
+        case "~":
+            c.emit(code.OpBitNot)
         default:
-            return fmt.Errorf("unkown operator %s", node.Operator)
+            return compileError(node, "unknown operator: %s", node.Operator)
         }
     case *ast.IfExpression:
-        err := c.Compile(node.Condition)
-        if err != nil {
-            return err
-        }
+        // every branch jumps to the common end, so we collect the jumps and patch them at the end
+        jmpPositions := []int{}
 
-        jneInsPos := c.emit(code.OpJNE, 6969)
+        branches := append([]*ast.IfExpression{node}, node.Alternative...)
+        for _, branch := range branches {
+            err := c.Compile(branch.Condition)
+            if err != nil {
+                return err
+            }
 
-        err = c.Compile(node.Consequence)
-        if err != nil {
-            return err
-        }
-        if c.lastInsIs(code.OpPop) { // remove the pop created by consequence
-            c.removeLastPop()
-        }
+            jneInsPos := c.emit(code.OpJNE, 6969)
 
-        // TODO: this is deeply wrong(meaning the ast is generated wrongly)
-        // and hence the generated code is wrong. fix them all
-        for _, alt := range node.Alternative {
-            err := c.Compile(alt)
+            err = c.compileBranch(branch.Consequence)
             if err != nil {
                 return err
             }
-        }
 
-        jmpPos := c.emit(code.OpJmp, 6969)
+            jmpPositions = append(jmpPositions, c.emit(code.OpJmp, 6969))
 
-        c.changeOperand(jneInsPos, len(c.currentInstructions()))
+            // if the condition fails we go on to test the next alternative
+            c.changeOperand(jneInsPos, len(c.currentInstructions()))
+        }
 
         if node.Default == nil {
             c.emit(code.OpNull)
         } else {
-            err := c.Compile(node.Default)
+            err := c.compileBranch(node.Default)
             if err != nil {
                 return err
             }
-            if c.lastInsIs(code.OpPop) { // remove the pop created by consequence
-                c.removeLastPop()
-            }
         }
 
-        c.changeOperand(jmpPos, len(c.currentInstructions()))
+        for _, jmpPos := range jmpPositions {
+            c.changeOperand(jmpPos, len(c.currentInstructions()))
+        }
 
+    case *ast.MatchExpression:
+        return c.compileMatch(node)
     case *ast.IntegerLiteral:
         integer := &object.Integer{Value: node.Value}
         c.emit(code.OpConstant, c.addConstant(integer)) // the index in constant pool
+    case *ast.FloatLiteral:
+        float := &object.Float{Value: node.Value}
+        c.emit(code.OpConstant, c.addConstant(float))
     case *ast.Boolean:
         if node.Value {
             c.emit(code.OpTrue)
         } else {
             c.emit(code.OpFalse)
         }
+    case *ast.InterpolatedString:
+        for _, part := range node.Parts {
+            err := c.Compile(part)
+            if err != nil {
+                return err
+            }
+        }
+
+        c.emit(code.OpBuildString, len(node.Parts))
     case *ast.StringLiteral:
         str := &object.String{Value: node.Value}
         c.emit(code.OpConstant, c.addConstant(str))
     case *ast.Identifier:
         symbol, ok := c.symTable.Resolve(node.Value)
         if !ok {
-            return fmt.Errorf("undefined variable %s", node.Value)
+            return compileError(node, "undefined variable %s", node.Value)
         }
 
-        if symbol.Scope == GlobalScope {
-            c.emit(code.OpGetGlobal, symbol.Index)
-        } else {
-            c.emit(code.OpGetLocal, symbol.Index)
-        }
+        c.loadSymbol(symbol)
     case *ast.ArrayLiteral:
         for _, elem := range node.Elements {
             err := c.Compile(elem)
@@ -267,11 +449,40 @@ func (c *Compiler) Compile(node ast.Node) error {
         }
 
         c.emit(code.OpIndex)
+    case *ast.AssignExpression:
+        return c.compileAssignment(node)
     case *ast.FunctionLiteral:
         c.enterScope()
+        c.scopes[c.scopeIndex].tailCalls = map[*ast.CallExpression]bool{}
+        markTailCalls(node.Body, c.scopes[c.scopeIndex].tailCalls)
 
+        if node.Name != "" {
+            c.symTable.DefineFunctionName(node.Name)
+        }
+
+        // the parameters take the first locals in the order the VM lays the arguments out
+        params := []Symbol{}
         for _, param := range node.Parameters {
-            c.symTable.Define(param.Value)
+            params = append(params, c.symTable.Define(param.Value))
+        }
+        if node.Rest != nil {
+            c.symTable.Define(node.Rest.Value)
+        }
+
+        numDefaults := 0
+        for i, defaultValue := range node.Defaults {
+            if defaultValue == nil {
+                continue
+            }
+            numDefaults++
+
+            jumpPos := c.emit(code.OpJumpIfArg, 6969, i)
+            err := c.Compile(defaultValue)
+            if err != nil {
+                return err
+            }
+            c.storeSymbol(params[i])
+            c.changeOperand(jumpPos, len(c.currentInstructions()), i)
         }
 
         err := c.Compile(node.Body)
@@ -287,20 +498,46 @@ func (c *Compiler) Compile(node ast.Node) error {
             c.emit(code.OpReturn)
         }
 
+        freeSymbols := c.symTable.FreeSymbols
         numLocals := c.symTable.num_def
+        positions := c.scopes[c.scopeIndex].positions
         instructions := c.leaveScope()
+
+        // push the captured variables so OpClosure can take them off the stack
+        for _, sym := range freeSymbols {
+            c.captureSymbol(sym)
+        }
+
         compiledFun := &object.CompiledFunction{
             Instructions: instructions,
             NumLocals: numLocals,
             NumParams: len(node.Parameters),
+            NumDefaults: numDefaults,
+            Variadic: node.Rest != nil,
+            Name: node.Name,
+            Positions: positions,
         }
-        c.emit(code.OpConstant, c.addConstant(compiledFun))
+        c.emit(code.OpClosure, c.addConstant(compiledFun), len(freeSymbols))
+    case *ast.ImportExpression:
+        return c.compileImport(node)
     case *ast.ReturnStatement:
+        // a finally would have to run after the call, so only a return outside of any try is a tail call
+        scope := c.scopes[c.scopeIndex]
+        if call, ok := node.ReturnValue.(*ast.CallExpression); ok && scope.tailCalls != nil && len(scope.tries) == 0 {
+            scope.tailCalls[call] = true
+        }
+
         err := c.Compile(node.ReturnValue)
         if err != nil {
             return err
         }
 
+        // the return value waits on the stack while the finally blocks run
+        err = c.leaveTries(0)
+        if err != nil {
+            return err
+        }
+
         c.emit(code.OpReturnValue)
     case *ast.CallExpression:
         err := c.Compile(node.Function)
@@ -315,15 +552,308 @@ func (c *Compiler) Compile(node ast.Node) error {
             }
         }
 
-        c.emit(code.OpCall, len(node.Arguments))
+        if c.scopes[c.scopeIndex].tailCalls[node] {
+            c.emit(code.OpTailCall, len(node.Arguments))
+        } else {
+            c.emit(code.OpCall, len(node.Arguments))
+        }
+    }
+    return nil
+}
+
+// markTailCalls records the calls a block ends with, the ones whose value is the value of the
+// block. that's its last expression, or the last ones of the if branches or match arms it ends with.
+func markTailCalls(block *ast.BlockStatement, calls map[*ast.CallExpression]bool) {
+    if block == nil || len(block.Statements) == 0 {
+        return
+    }
+
+    if stmt, ok := block.Statements[len(block.Statements)-1].(*ast.ExpressionStatement); ok {
+        markTailExpression(stmt.Expression, calls)
+    }
+}
+
+func markTailExpression(expr ast.Expression, calls map[*ast.CallExpression]bool) {
+    switch expr := expr.(type) {
+    case *ast.CallExpression:
+        calls[expr] = true
+    case *ast.IfExpression:
+        markTailCalls(expr.Consequence, calls)
+        for _, alt := range expr.Alternative {
+            markTailCalls(alt.Consequence, calls)
+        }
+        markTailCalls(expr.Default, calls)
+    case *ast.MatchExpression:
+        for _, arm := range expr.Arms {
+            markTailExpression(arm.Value, calls)
+        }
+    }
+}
+
+// compiles the body of an if branch so that it leaves exactly one value on the stack
+func (c *Compiler) compileBranch(block *ast.BlockStatement) error {
+    err := c.Compile(block)
+    if err != nil {
+        return err
+    }
+
+    if c.lastInsIs(code.OpPop) { // remove the pop created by the last expression statement
+        c.removeLastPop()
+    } else {
+        c.emit(code.OpNull) // the block ended without an expression to produce a value
+    }
+
+    return nil
+}
+
+// the left operand stays on the stack if it decides the result, otherwise
+// it's popped and the right operand is evaluated
+func (c *Compiler) compileLogicalExpression(node *ast.InfixExpression) error {
+    err := c.Compile(node.Left)
+    if err != nil {
+        return err
+    }
+
+    op := code.OpJumpIfFalsy
+    if node.Operator == "||" {
+        op = code.OpJumpIfTruthy
+    }
+    jumpPos := c.emit(op, 6969)
+
+    err = c.Compile(node.Right)
+    if err != nil {
+        return err
+    }
+
+    c.changeOperand(jumpPos, len(c.currentInstructions()))
+
+    return nil
+}
+
+// assignments leave the assigned value on the stack since they're expressions
+func (c *Compiler) compileAssignment(node *ast.AssignExpression) error {
+    switch target := node.Target.(type) {
+    case *ast.Identifier:
+        symbol, ok := c.symTable.Resolve(target.Value)
+        if !ok {
+            return compileError(target, "cannot assign to undefined variable %s", target.Value)
+        }
+
+        switch symbol.Scope {
+        case FreeScope:
+            if c.symTable.capturedFrom(symbol) == FunctionScope {
+                return compileError(target, "cannot assign to function name %s", target.Value)
+            }
+        case BuiltinScope:
+            return compileError(target, "cannot assign to builtin %s", target.Value)
+        case FunctionScope:
+            return compileError(target, "cannot assign to function name %s", target.Value)
+        }
+
+        err := c.Compile(node.Value)
+        if err != nil {
+            return err
+        }
+
+        c.storeSymbol(symbol)
+        c.loadSymbol(symbol)
+    case *ast.IndexExpression:
+        err := c.Compile(target.Left)
+        if err != nil {
+            return err
+        }
+
+        err = c.Compile(target.Index)
+        if err != nil {
+            return err
+        }
+
+        err = c.Compile(node.Value)
+        if err != nil {
+            return err
+        }
+
+        c.emit(code.OpSetIndex)
+    default:
+        return compileError(node, "cannot assign to %s", node.Target.String())
+    }
+
+    return nil
+}
+
+// the unpack opcodes leave the values on the stack in pattern order, so they're stored last to first
+func (c *Compiler) compileDestructuring(node *ast.LetStatement) error {
+    err := c.Compile(node.Value)
+    if err != nil {
+        return err
+    }
+
+    var names []*ast.Identifier
+
+    switch pattern := node.Pattern.(type) {
+    case *ast.ArrayPattern:
+        names = pattern.Elements
+        hasRest := 0
+        if pattern.Rest != nil {
+            names = append(names[:len(names):len(names)], pattern.Rest)
+            hasRest = 1
+        }
+        c.emit(code.OpUnpackArray, len(pattern.Elements), hasRest)
+    case *ast.HashPattern:
+        names = pattern.Keys
+        for _, key := range pattern.Keys {
+            c.emit(code.OpConstant, c.addConstant(&object.String{Value: key.Value}))
+        }
+        c.emit(code.OpUnpackHash, len(pattern.Keys))
+    }
+
+    symbols := []Symbol{}
+    for _, name := range names {
+        symbols = append(symbols, c.symTable.Define(name.Value))
+    }
+
+    for i := len(symbols) - 1; i >= 0; i-- {
+        c.storeSymbol(symbols[i])
     }
+
     return nil
 }
 
+func (c *Compiler) storeSymbol(s Symbol) {
+    switch s.Scope {
+    case GlobalScope:
+        c.emit(code.OpSetGlobal, s.Index)
+    case FreeScope:
+        c.emit(code.OpSetFree, s.Index)
+    default:
+        c.emit(code.OpSetLocal, s.Index)
+    }
+}
+
+// bindSymbol stores a variable that's new each time it's stored, a closure that captured
+// the one before keeps it
+func (c *Compiler) bindSymbol(s Symbol) {
+    if s.Scope == GlobalScope {
+        c.emit(code.OpSetGlobal, s.Index)
+    } else {
+        c.emit(code.OpBindLocal, s.Index)
+    }
+}
+
+// captureSymbol pushes what a new closure keeps of a variable it captures
+func (c *Compiler) captureSymbol(s Symbol) {
+    switch s.Scope {
+    case LocalScope:
+        c.emit(code.OpCaptureLocal, s.Index)
+    case FreeScope:
+        c.emit(code.OpCaptureFree, s.Index)
+    default:
+        c.loadSymbol(s)
+    }
+}
+
+func (c *Compiler) loadSymbol(s Symbol) {
+    switch s.Scope {
+    case GlobalScope:
+        c.emit(code.OpGetGlobal, s.Index)
+    case LocalScope:
+        c.emit(code.OpGetLocal, s.Index)
+    case FreeScope:
+        c.emit(code.OpGetFree, s.Index)
+    case BuiltinScope:
+        c.emit(code.OpGetBuiltin, s.Index)
+    case FunctionScope:
+        c.emit(code.OpCurrentClosure)
+    }
+}
+
+// the module runs the first time its import is reached, after that OpImport jumps straight to the end
+func (c *Compiler) compileImport(node *ast.ImportExpression) error {
+    path := module.Resolve(node.Path, node.Pos())
+
+    mod, ok := c.symTable.globals.modules[path]
+    if !ok {
+        var err error
+        mod, err = c.compileModule(node, path)
+        if err != nil {
+            return err
+        }
+    }
+
+    importPos := c.emit(code.OpImport, mod.slot, 6969)
+    c.emit(code.OpClosure, mod.fn, 0)
+    c.emit(code.OpCall, 0)
+    c.emit(code.OpSetGlobal, mod.slot)
+    c.emit(code.OpGetGlobal, mod.slot)
+    c.changeOperand(importPos, mod.slot, len(c.currentInstructions()))
+
+    return nil
+}
+
+// a module is compiled once into a function that runs its top level and returns its namespace.
+// its top level names are globals of their own, so they can't clash with the importer's.
+func (c *Compiler) compileModule(node *ast.ImportExpression, path string) (compiledModule, error) {
+    err := c.importing.Enter(node.Pos(), path)
+    if err != nil {
+        return compiledModule{}, compileError(node, "%s", err)
+    }
+    defer c.importing.Leave()
+
+    program, err := module.Parse(path)
+    if err != nil {
+        return compiledModule{}, compileError(node, "%s", err)
+    }
+
+    importer := c.symTable
+    c.enterScope()
+    c.symTable = NewModuleSymTable(importer)
+    for i, b := range object.Builtins {
+        c.symTable.DefineBuiltin(i, b.Name)
+    }
+
+    err = c.Compile(program)
+    if err != nil {
+        // back out of the module's scope, or whatever is compiled next would end up in it
+        c.leaveScope()
+        c.symTable = importer
+        return compiledModule{}, err
+    }
+
+    exports := program.Exports()
+    for _, name := range exports {
+        symbol, _ := c.symTable.Resolve(name.Value)
+        c.emit(code.OpConstant, c.addConstant(&object.String{Value: name.Value}))
+        c.loadSymbol(symbol)
+    }
+    c.emit(code.OpModule, c.addConstant(&object.String{Value: path}), len(exports))
+    c.emit(code.OpReturnValue)
+
+    slot := c.symTable.Define("@module")
+    positions := c.scopes[c.scopeIndex].positions
+    instructions := c.leaveScope()
+    c.symTable = importer
+
+    fn := &object.CompiledFunction{
+        Instructions: instructions,
+        Name: "<module " + path + ">",
+        Positions: positions,
+    }
+    mod := compiledModule{fn: c.addConstant(fn), slot: slot.Index}
+    c.symTable.globals.modules[path] = mod
+
+    return mod, nil
+}
+
+// compile errors are reported as "file:line:col: message"
+func compileError(node ast.Node, format string, a ...interface{}) error {
+    return fmt.Errorf("%s: %s", node.Pos(), fmt.Sprintf(format, a...))
+}
+
 func (c *Compiler) Bytecode() *Bytecode {
     return &Bytecode{
         Instructions: c.currentInstructions(),
         Constants: c.Constants,
+        Positions: c.scopes[c.scopeIndex].positions,
     }
 }
 
@@ -336,9 +866,23 @@ func (c *Compiler) addInstruction(ins []byte) int {
     pos_new_ins := len(c.currentInstructions())
     updatedInstructions := append(c.currentInstructions(), ins...)
     c.scopes[c.scopeIndex].instructions = updatedInstructions
+    c.addPosition(pos_new_ins)
     return pos_new_ins
 }
 
+func (c *Compiler) addPosition(offset int) {
+    positions := c.scopes[c.scopeIndex].positions
+    if !c.pos.IsValid() {
+        return
+    }
+
+    if len(positions) > 0 && positions[len(positions)-1].Pos == c.pos {
+        return
+    }
+
+    c.scopes[c.scopeIndex].positions = append(positions, code.SourcePos{Offset: offset, Pos: c.pos})
+}
+
 // NOTE: the new Instruction should be the same width as the old one
 func (c *Compiler) replaceInstruction(newIns []byte, pos int) {
     instructions := c.currentInstructions()
@@ -347,9 +891,9 @@ func (c *Compiler) replaceInstruction(newIns []byte, pos int) {
     }
 }
 
-func (c *Compiler) changeOperand(opPos int, operand int) {
+func (c *Compiler) changeOperand(opPos int, operands ...int) {
     op := code.Opcode(c.currentInstructions()[opPos])
-    newIns := code.Make(op, operand)
+    newIns := code.Make(op, operands...)
     c.replaceInstruction(newIns, opPos)
 }
 
@@ -391,6 +935,13 @@ func (c *Compiler) removeLastPop() {
 
     c.scopes[c.scopeIndex].instructions = new
     c.scopes[c.scopeIndex].lastIns = prev
+
+    // drop the position entries of the removed instruction
+    positions := c.scopes[c.scopeIndex].positions
+    for len(positions) > 0 && positions[len(positions)-1].Offset >= last.Pos {
+        positions = positions[:len(positions)-1]
+    }
+    c.scopes[c.scopeIndex].positions = positions
 }
 
 func (c *Compiler) replaceLastPopWithReturn() {
@@ -400,6 +951,333 @@ func (c *Compiler) replaceLastPopWithReturn() {
     c.scopes[c.scopeIndex].lastIns.Opcode = code.OpReturnValue
 }
 
+func (c *Compiler) enterLoop(continuePos int) *loopContext {
+    loop := &loopContext{continuePos: continuePos, tries: len(c.scopes[c.scopeIndex].tries)}
+    c.scopes[c.scopeIndex].loops = append(c.scopes[c.scopeIndex].loops, loop)
+    return loop
+}
+
+func (c *Compiler) leaveLoop() {
+    loops := c.scopes[c.scopeIndex].loops
+    c.scopes[c.scopeIndex].loops = loops[:len(loops)-1]
+}
+
+func (c *Compiler) currentLoop() *loopContext {
+    loops := c.scopes[c.scopeIndex].loops
+    if len(loops) == 0 {
+        return nil
+    }
+    return loops[len(loops)-1]
+}
+
+// try { B } catch (e) { C } finally { F } compiles to
+//
+//         OpTry catch
+//         B
+//         OpEndTry
+//         F
+//         OpJmp end
+//  catch: (the vm pushed the exception) store e
+//         OpTry rethrow
+//         C
+//         OpEndTry
+//         F
+//         OpJmp end
+// rethrow: F
+//         OpRethrow (the exception is still on the stack)
+//    end:
+//
+// without a finally the catch block isn't guarded and there's no rethrow, without a catch
+// the first OpTry goes straight to the rethrow. a finally is copied to every way out of the
+// blocks, return, break and continue included.
+func (c *Compiler) compileTryStatement(node *ast.TryStatement) error {
+    endJumps := []int{}
+
+    handlerPos := c.emit(code.OpTry, 6969)
+    err := c.compileTryBlock(node.Body, node.Finally)
+    if err != nil {
+        return err
+    }
+    endJumps = append(endJumps, c.emit(code.OpJmp, 6969))
+    c.changeOperand(handlerPos, len(c.currentInstructions()))
+
+    if node.Catch != nil {
+        c.storeSymbol(c.symTable.Define(node.CatchParam.Value))
+
+        if node.Finally == nil {
+            err = c.Compile(node.Catch)
+        } else {
+            handlerPos = c.emit(code.OpTry, 6969)
+            err = c.compileTryBlock(node.Catch, node.Finally)
+        }
+        if err != nil {
+            return err
+        }
+        endJumps = append(endJumps, c.emit(code.OpJmp, 6969))
+
+        if node.Finally != nil {
+            c.changeOperand(handlerPos, len(c.currentInstructions()))
+        }
+    }
+
+    if node.Finally != nil {
+        err = c.Compile(node.Finally)
+        if err != nil {
+            return err
+        }
+        c.emit(code.OpRethrow)
+    }
+
+    for _, jmpPos := range endJumps {
+        c.changeOperand(jmpPos, len(c.currentInstructions()))
+    }
+
+    return nil
+}
+
+// a block guarded by the OpTry just emitted, followed by its OpEndTry and the finally
+func (c *Compiler) compileTryBlock(block *ast.BlockStatement, finally *ast.BlockStatement) error {
+    scope := &c.scopes[c.scopeIndex]
+    scope.tries = append(scope.tries, &tryContext{finally: finally})
+
+    err := c.Compile(block)
+
+    scope = &c.scopes[c.scopeIndex]
+    scope.tries = scope.tries[:len(scope.tries)-1]
+    if err != nil {
+        return err
+    }
+
+    c.emit(code.OpEndTry)
+    if finally == nil {
+        return nil
+    }
+    return c.Compile(finally)
+}
+
+// jumping out of try blocks drops their handlers and runs their finally blocks, innermost first.
+// depth is how many of the function's try blocks stay entered.
+func (c *Compiler) leaveTries(depth int) error {
+    tries := c.scopes[c.scopeIndex].tries
+
+    for i := len(tries) - 1; i >= depth; i-- {
+        c.emit(code.OpEndTry)
+        if tries[i].finally == nil {
+            continue
+        }
+
+        // a finally runs outside of its own try
+        c.scopes[c.scopeIndex].tries = tries[:i]
+        err := c.Compile(tries[i].finally)
+        c.scopes[c.scopeIndex].tries = tries
+        if err != nil {
+            return err
+        }
+    }
+
+    return nil
+}
+
+// the subject is kept in a hidden variable and each arm checks it piece by piece, going on to
+// the next arm at the first check that fails:
+//
+//         <subject>, store @match
+//         <checks of pattern 1>, each followed by OpJNE arm2
+//         <guard 1>, OpJNE arm2
+//         <value 1>
+//         OpJmp end
+//   arm2: ...
+//         load @match, OpNoMatch
+//    end:
+func (c *Compiler) compileMatch(node *ast.MatchExpression) error {
+    err := c.Compile(node.Subject)
+    if err != nil {
+        return err
+    }
+
+    subject := c.symTable.Define("@match")
+    c.storeSymbol(subject)
+    load := func() error {
+        c.loadSymbol(subject)
+        return nil
+    }
+
+    endJumps := []int{}
+    for _, arm := range node.Arms {
+        endJump, err := c.compileMatchArm(arm, load)
+        if err != nil {
+            return err
+        }
+        endJumps = append(endJumps, endJump)
+    }
+
+    c.loadSymbol(subject)
+    c.emit(code.OpNoMatch)
+
+    for _, jmpPos := range endJumps {
+        c.changeOperand(jmpPos, len(c.currentInstructions()))
+    }
+
+    return nil
+}
+
+// an arm falls through to the next one when it doesn't match, and returns the position of its jump
+// to the end of the match. the names its pattern binds are only visible inside the arm
+func (c *Compiler) compileMatchArm(arm *ast.MatchArm, load func() error) (int, error) {
+    restore := c.symTable.shadow(patternNames(arm.Pattern))
+    defer restore()
+
+    failJumps := []int{}
+
+    err := c.compileMatchPattern(arm.Pattern, load, &failJumps)
+    if err != nil {
+        return 0, err
+    }
+
+    if arm.Guard != nil {
+        err = c.Compile(arm.Guard)
+        if err != nil {
+            return 0, err
+        }
+        failJumps = append(failJumps, c.emit(code.OpJNE, 6969))
+    }
+
+    err = c.Compile(arm.Value)
+    if err != nil {
+        return 0, err
+    }
+    endJump := c.emit(code.OpJmp, 6969)
+
+    for _, jmpPos := range failJumps {
+        c.changeOperand(jmpPos, len(c.currentInstructions()))
+    }
+
+    return endJump, nil
+}
+
+// the names a pattern binds
+func patternNames(pattern ast.MatchPattern) []string {
+    names := []string{}
+
+    switch pattern := pattern.(type) {
+    case *ast.BindingPattern:
+        names = append(names, pattern.Name.Value)
+    case *ast.ArrayMatchPattern:
+        for _, element := range pattern.Elements {
+            names = append(names, patternNames(element)...)
+        }
+        if pattern.Rest != nil && pattern.Rest.Value != "_" {
+            names = append(names, pattern.Rest.Value)
+        }
+    case *ast.HashMatchPattern:
+        for _, value := range pattern.Values {
+            names = append(names, patternNames(value)...)
+        }
+    }
+
+    return names
+}
+
+// load pushes the value the pattern is checked against. a failed check jumps to whatever
+// failJumps gets patched to, the names of the pattern are stored as soon as they're reached
+func (c *Compiler) compileMatchPattern(pattern ast.MatchPattern, load func() error, failJumps *[]int) error {
+    switch pattern := pattern.(type) {
+    case *ast.WildcardPattern:
+        return nil
+    case *ast.BindingPattern:
+        err := load()
+        if err != nil {
+            return err
+        }
+        c.bindSymbol(c.symTable.Define(pattern.Name.Value))
+    case *ast.LiteralPattern:
+        err := load()
+        if err != nil {
+            return err
+        }
+        err = c.Compile(pattern.Value)
+        if err != nil {
+            return err
+        }
+        c.emit(code.OpMatchLiteral)
+        *failJumps = append(*failJumps, c.emit(code.OpJNE, 6969))
+    case *ast.ArrayMatchPattern:
+        hasRest := 0
+        if pattern.Rest != nil {
+            hasRest = 1
+        }
+
+        err := load()
+        if err != nil {
+            return err
+        }
+        c.emit(code.OpMatchArray, len(pattern.Elements), hasRest)
+        *failJumps = append(*failJumps, c.emit(code.OpJNE, 6969))
+
+        for i, element := range pattern.Elements {
+            index := c.addConstant(&object.Integer{Value: int64(i)})
+            loadElement := func() error {
+                err := load()
+                if err != nil {
+                    return err
+                }
+                c.emit(code.OpConstant, index)
+                c.emit(code.OpIndex)
+                return nil
+            }
+
+            err = c.compileMatchPattern(element, loadElement, failJumps)
+            if err != nil {
+                return err
+            }
+        }
+
+        if pattern.Rest != nil && pattern.Rest.Value != "_" {
+            err = load()
+            if err != nil {
+                return err
+            }
+            c.emit(code.OpArrayRest, len(pattern.Elements))
+            c.bindSymbol(c.symTable.Define(pattern.Rest.Value))
+        }
+    case *ast.HashMatchPattern:
+        err := load()
+        if err != nil {
+            return err
+        }
+        for _, key := range pattern.Keys {
+            err = c.Compile(key)
+            if err != nil {
+                return err
+            }
+        }
+        c.emit(code.OpMatchHash, len(pattern.Keys))
+        *failJumps = append(*failJumps, c.emit(code.OpJNE, 6969))
+
+        for i, key := range pattern.Keys {
+            loadValue := func() error {
+                err := load()
+                if err != nil {
+                    return err
+                }
+                err = c.Compile(key)
+                if err != nil {
+                    return err
+                }
+                c.emit(code.OpIndex)
+                return nil
+            }
+
+            err = c.compileMatchPattern(pattern.Values[i], loadValue, failJumps)
+            if err != nil {
+                return err
+            }
+        }
+    }
+
+    return nil
+}
+
 func (c *Compiler) enterScope() {
     scope := CompilationScope{
         instructions: code.Instructions{},
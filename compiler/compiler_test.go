@@ -7,6 +7,8 @@ import (
 	"monkey/lexer"
 	"monkey/object"
 	"monkey/parser"
+	"os"
+	"path/filepath"
 	"testing"
 )
 
@@ -73,6 +75,69 @@ func TestIntegerArithmetic(t *testing.T) {
 				code.Make(code.OpPop),
 			},
 		},
+		{
+			input:             "1 % 2 & 3 | 4 ^ 5",
+			expectedConstants: []interface{}{1, 2, 3, 4, 5},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpMod),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpBitAnd),
+				code.Make(code.OpConstant, 3),
+				code.Make(code.OpBitOr),
+				code.Make(code.OpConstant, 4),
+				code.Make(code.OpBitXor),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "1 << 2 >> 3",
+			expectedConstants: []interface{}{1, 2, 3},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpShiftLeft),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpShiftRight),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "~1",
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpBitNot),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestFloatArithmetic(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "1.5 * 2",
+			expectedConstants: []interface{}{1.5, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpMul),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "-2.5e-1",
+			expectedConstants: []interface{}{0.25},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpMinus),
+				code.Make(code.OpPop),
+			},
+		},
 	}
 
 	runCompilerTests(t, tests)
@@ -106,6 +171,26 @@ func TestBooleanExpression(t *testing.T) {
 				code.Make(code.OpPop),
 			},
 		},
+		{
+			input:             "1 >= 2",
+			expectedConstants: []interface{}{2, 1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpLessEqual),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "1 <= 2",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpLessEqual),
+				code.Make(code.OpPop),
+			},
+		},
 		{
 			input:             "1 < 2",
 			expectedConstants: []interface{}{1, 2},
@@ -170,6 +255,37 @@ func TestBooleanExpression(t *testing.T) {
 	runCompilerTests(t, tests)
 }
 
+func TestLogicalExpressions(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "true && false; 1",
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpTrue),            // 0000
+				code.Make(code.OpJumpIfFalsy, 5),  // 0001
+				code.Make(code.OpFalse),           // 0004
+				code.Make(code.OpPop),             // 0005
+				code.Make(code.OpConstant, 0),     // 0006
+				code.Make(code.OpPop),             // 0009
+			},
+		},
+		{
+			input:             "false || true && false",
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpFalse),           // 0000
+				code.Make(code.OpJumpIfTruthy, 9), // 0001
+				code.Make(code.OpTrue),            // 0004
+				code.Make(code.OpJumpIfFalsy, 9),  // 0005
+				code.Make(code.OpFalse),           // 0008
+				code.Make(code.OpPop),             // 0009
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
 func TestConditionals(t *testing.T) {
 	tests := []compilerTestCase{
 		{
@@ -212,6 +328,195 @@ func TestConditionals(t *testing.T) {
 				code.Make(code.OpPop),
 			},
 		},
+		{
+			input: `
+			if (true) { 10 } else if (false) { 20 }; 3333;
+			`,
+			expectedConstants: []interface{}{10, 20, 3333},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpTrue),        // 0000
+				code.Make(code.OpJNE, 10),     // 0001
+				code.Make(code.OpConstant, 0), // 0004
+				code.Make(code.OpJmp, 21),     // 0007
+				code.Make(code.OpFalse),       // 0010
+				code.Make(code.OpJNE, 20),     // 0011
+				code.Make(code.OpConstant, 1), // 0014
+				code.Make(code.OpJmp, 21),     // 0017
+				code.Make(code.OpNull),        // 0020
+				code.Make(code.OpPop),         // 0021
+				code.Make(code.OpConstant, 2), // 0022
+				code.Make(code.OpPop),         // 0025
+			},
+		},
+		{
+			input: `
+			if (true) { 10 } else if (false) { 20 } else { 30 }; 3333;
+			`,
+			expectedConstants: []interface{}{10, 20, 30, 3333},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpTrue),        // 0000
+				code.Make(code.OpJNE, 10),     // 0001
+				code.Make(code.OpConstant, 0), // 0004
+				code.Make(code.OpJmp, 23),     // 0007
+				code.Make(code.OpFalse),       // 0010
+				code.Make(code.OpJNE, 20),     // 0011
+				code.Make(code.OpConstant, 1), // 0014
+				code.Make(code.OpJmp, 23),     // 0017
+				code.Make(code.OpConstant, 2), // 0020
+				code.Make(code.OpPop),         // 0023
+				code.Make(code.OpConstant, 3), // 0024
+				code.Make(code.OpPop),         // 0027
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestWhileStatements(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: `
+			while (true) { 10 }; 3333;
+			`,
+			expectedConstants: []interface{}{10, 3333},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpTrue),        // 0000
+				code.Make(code.OpJNE, 11),     // 0001
+				code.Make(code.OpConstant, 0), // 0004
+				code.Make(code.OpPop),         // 0007
+				code.Make(code.OpJmp, 0),      // 0008
+				code.Make(code.OpConstant, 1), // 0011
+				code.Make(code.OpPop),         // 0014
+			},
+		},
+		{
+			input: `
+			while (true) { break; continue; }
+			`,
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpTrue),    // 0000
+				code.Make(code.OpJNE, 13), // 0001
+				code.Make(code.OpJmp, 13), // 0004
+				code.Make(code.OpJmp, 0),  // 0007
+				code.Make(code.OpJmp, 0),  // 0010
+			},
+		},
+		{
+			input: `
+			while (true) { while (false) { break; } break; }
+			`,
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpTrue),    // 0000
+				code.Make(code.OpJNE, 20), // 0001
+				code.Make(code.OpFalse),   // 0004
+				code.Make(code.OpJNE, 14), // 0005
+				code.Make(code.OpJmp, 14), // 0008
+				code.Make(code.OpJmp, 4),  // 0011
+				code.Make(code.OpJmp, 20), // 0014
+				code.Make(code.OpJmp, 0),  // 0017
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestForStatements(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: `
+			for (x in [1]) { x; break; }
+			`,
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),    // 0000
+				code.Make(code.OpArray, 1),       // 0003
+				code.Make(code.OpIter),           // 0006
+				code.Make(code.OpSetGlobal, 0),   // 0007
+				code.Make(code.OpGetGlobal, 0),   // 0010
+				code.Make(code.OpIterNext, 30, 1), // 0013
+				code.Make(code.OpSetGlobal, 1),   // 0017
+				code.Make(code.OpGetGlobal, 1),   // 0020
+				code.Make(code.OpPop),            // 0023
+				code.Make(code.OpJmp, 30),        // 0024
+				code.Make(code.OpJmp, 10),        // 0027
+			},
+		},
+		{
+			input: `
+			fn(h) { for (k, v in h) { continue; } }
+			`,
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpGetLocal, 0),    // 0000
+					code.Make(code.OpIter),           // 0002
+					code.Make(code.OpSetLocal, 1),    // 0003
+					code.Make(code.OpGetLocal, 1),    // 0005
+					code.Make(code.OpIterNext, 21, 2), // 0007
+					code.Make(code.OpSetLocal, 2),    // 0011
+					code.Make(code.OpSetLocal, 3),    // 0013
+					code.Make(code.OpJmp, 5),         // 0015
+					code.Make(code.OpJmp, 5),         // 0018
+					code.Make(code.OpReturn),         // 0021
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 0, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestAssignExpressions(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "let a = 1; a = 2;",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "fn(a) { a = 2 }",
+			expectedConstants: []interface{}{
+				2,
+				[]code.Instructions{
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpSetLocal, 0),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "let a = [1]; a[0] = 2;",
+			expectedConstants: []interface{}{1, 0, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpArray, 1),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpSetIndex),
+				code.Make(code.OpPop),
+			},
+		},
 	}
 
 	runCompilerTests(t, tests)
@@ -265,6 +570,45 @@ func TestGlobalLetStatements(t *testing.T) {
 	runCompilerTests(t, tests)
 }
 
+func TestDestructuringLetStatements(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "let [a, ...b] = [1, 2];",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpArray, 2),
+				code.Make(code.OpUnpackArray, 1, 1),
+				code.Make(code.OpSetGlobal, 1),
+				code.Make(code.OpSetGlobal, 0),
+			},
+		},
+		{
+			input:             `fn(h) { let {x, y} = h; }`,
+			expectedConstants: []interface{}{
+				"x",
+				"y",
+				[]code.Instructions{
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpConstant, 1),
+					code.Make(code.OpUnpackHash, 2),
+					code.Make(code.OpSetLocal, 2),
+					code.Make(code.OpSetLocal, 1),
+					code.Make(code.OpReturn),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 2, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
 func TestStringExpressions(t *testing.T) {
 	tests := []compilerTestCase{
 		{
@@ -285,6 +629,19 @@ func TestStringExpressions(t *testing.T) {
 				code.Make(code.OpPop),
 			},
 		},
+		{
+			input:             `"n: ${1 + 2}!"`,
+			expectedConstants: []interface{}{"n: ", 1, 2, "!"},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpAdd),
+				code.Make(code.OpConstant, 3),
+				code.Make(code.OpBuildString, 3),
+				code.Make(code.OpPop),
+			},
+		},
 	}
 	runCompilerTests(t, tests)
 }
@@ -427,7 +784,7 @@ func TestFunctions(t *testing.T) {
 				},
 			},
 			expectedInstructions: []code.Instructions{
-				code.Make(code.OpConstant, 2),
+				code.Make(code.OpClosure, 2, 0),
 				code.Make(code.OpPop),
 			},
 		},
@@ -443,7 +800,7 @@ func TestFunctions(t *testing.T) {
 				},
 			},
 			expectedInstructions: []code.Instructions{
-				code.Make(code.OpConstant, 2),
+				code.Make(code.OpClosure, 2, 0),
 				code.Make(code.OpPop),
 			},
 		},
@@ -460,7 +817,7 @@ func TestFunctions(t *testing.T) {
                 },
             },
             expectedInstructions: []code.Instructions{
-                code.Make(code.OpConstant, 2),
+                code.Make(code.OpClosure, 2, 0),
                 code.Make(code.OpPop),
             },
         },
@@ -468,32 +825,305 @@ func TestFunctions(t *testing.T) {
 	runCompilerTests(t, tests)
 }
 
-func TestFunctionsWithoutReturnValue(t *testing.T) {
+func TestDefaultAndRestParameters(t *testing.T) {
 	tests := []compilerTestCase{
 		{
-			input: `fn() { }`,
+			input: `fn(a, b = 10, ...rest) { b }`,
 			expectedConstants: []interface{}{
+				10,
 				[]code.Instructions{
-					code.Make(code.OpReturn),
+					code.Make(code.OpJumpIfArg, 9, 1),
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpSetLocal, 1),
+					code.Make(code.OpGetLocal, 1),
+					code.Make(code.OpReturnValue),
 				},
 			},
 			expectedInstructions: []code.Instructions{
-				code.Make(code.OpConstant, 0),
+				code.Make(code.OpClosure, 1, 0),
 				code.Make(code.OpPop),
 			},
 		},
 	}
 	runCompilerTests(t, tests)
+
+	tests2 := []struct {
+		input       string
+		numParams   int
+		numDefaults int
+		variadic    bool
+		numLocals   int
+	}{
+		{"fn(a, b) { }", 2, 0, false, 2},
+		{"fn(a, b = 1) { }", 2, 1, false, 2},
+		{"fn(a = 1, b = 2, ...rest) { let c = 3; }", 2, 2, true, 4},
+		{"fn(...rest) { }", 0, 0, true, 1},
+	}
+
+	for _, tt := range tests2 {
+		compiler := New_Compiler()
+		if err := compiler.Compile(parse(tt.input)); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		constants := compiler.Bytecode().Constants
+		fn, ok := constants[len(constants)-1].(*object.CompiledFunction)
+		if !ok {
+			t.Fatalf("last constant is not *object.CompiledFunction. got=%T", constants[len(constants)-1])
+		}
+
+		if fn.NumParams != tt.numParams || fn.NumDefaults != tt.numDefaults ||
+			fn.Variadic != tt.variadic || fn.NumLocals != tt.numLocals {
+			t.Errorf("wrong metadata for %q. want params=%d defaults=%d variadic=%t locals=%d, got params=%d defaults=%d variadic=%t locals=%d",
+				tt.input, tt.numParams, tt.numDefaults, tt.variadic, tt.numLocals,
+				fn.NumParams, fn.NumDefaults, fn.Variadic, fn.NumLocals)
+		}
+	}
 }
 
-func TestLetStatementScopes(t *testing.T) {tests := []compilerTestCase{
-	{
-		input: `
-		let num = 55;
-		fn() { num }
-		`,
-		expectedConstants: []interface{}{
-			55,
+func TestImports(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "m.monkey")
+	if err := os.WriteFile(path, []byte("export let a = 1;"), 0644); err != nil {
+		t.Fatalf("could not write module: %s", err)
+	}
+
+	tests := []compilerTestCase{
+		{
+			input: fmt.Sprintf(`import %q; import %q;`, path, path),
+			expectedConstants: []interface{}{
+				1,
+				"a",
+				path,
+				[]code.Instructions{
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpSetGlobal, 0),
+					code.Make(code.OpConstant, 1),
+					code.Make(code.OpGetGlobal, 0),
+					code.Make(code.OpModule, 2, 1),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpImport, 1, 17),
+				code.Make(code.OpClosure, 3, 0),
+				code.Make(code.OpCall, 0),
+				code.Make(code.OpSetGlobal, 1),
+				code.Make(code.OpGetGlobal, 1),
+				code.Make(code.OpPop),
+				// the second import reuses the compiled module
+				code.Make(code.OpImport, 1, 35),
+				code.Make(code.OpClosure, 3, 0),
+				code.Make(code.OpCall, 0),
+				code.Make(code.OpSetGlobal, 1),
+				code.Make(code.OpGetGlobal, 1),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestImportErrorLeavesModuleScope(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "bad.monkey")
+	if err := os.WriteFile(path, []byte("export let a = missing;"), 0644); err != nil {
+		t.Fatalf("could not write module: %s", err)
+	}
+
+	c := New_Compiler()
+	symTable := c.symTable
+
+	err := c.Compile(parse(fmt.Sprintf(`import %q`, path)))
+	if err == nil {
+		t.Fatalf("expected a compile error")
+	}
+
+	if c.scopeIndex != 0 || len(c.scopes) != 1 {
+		t.Errorf("compiler was left in the module's scope: scopeIndex=%d, scopes=%d", c.scopeIndex, len(c.scopes))
+	}
+	if c.symTable != symTable {
+		t.Errorf("compiler was left with the module's symbol table")
+	}
+}
+
+func TestTryStatements(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             `throw 1`,
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0), // 0000
+				code.Make(code.OpThrow),       // 0003
+			},
+		},
+		{
+			input:             `try { 1 } catch (e) { e }`,
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpTry, 11),      // 0000
+				code.Make(code.OpConstant, 0),  // 0003
+				code.Make(code.OpPop),          // 0006
+				code.Make(code.OpEndTry),       // 0007
+				code.Make(code.OpJmp, 21),      // 0008
+				code.Make(code.OpSetGlobal, 0), // 0011
+				code.Make(code.OpGetGlobal, 0), // 0014
+				code.Make(code.OpPop),          // 0017
+				code.Make(code.OpJmp, 21),      // 0018
+			},
+		},
+		{
+			input:             `try { 1 } catch (e) { e } finally { 2 }`,
+			expectedConstants: []interface{}{1, 2, 2, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpTry, 15),      // 0000
+				code.Make(code.OpConstant, 0),  // 0003
+				code.Make(code.OpPop),          // 0006
+				code.Make(code.OpEndTry),       // 0007
+				code.Make(code.OpConstant, 1),  // 0008
+				code.Make(code.OpPop),          // 0011
+				code.Make(code.OpJmp, 38),      // 0012
+				code.Make(code.OpSetGlobal, 0), // 0015
+				code.Make(code.OpTry, 33),      // 0018
+				code.Make(code.OpGetGlobal, 0), // 0021
+				code.Make(code.OpPop),          // 0024
+				code.Make(code.OpEndTry),       // 0025
+				code.Make(code.OpConstant, 2),  // 0026
+				code.Make(code.OpPop),          // 0029
+				code.Make(code.OpJmp, 38),      // 0030
+				code.Make(code.OpConstant, 3),  // 0033
+				code.Make(code.OpPop),          // 0036
+				code.Make(code.OpRethrow),      // 0037
+			},
+		},
+		{
+			input:             `while (true) { try { break; } finally { 1 } }`,
+			expectedConstants: []interface{}{1, 1, 1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpTrue),        // 0000
+				code.Make(code.OpJNE, 31),     // 0001
+				code.Make(code.OpTry, 23),     // 0004
+				code.Make(code.OpEndTry),      // 0007
+				code.Make(code.OpConstant, 0), // 0008
+				code.Make(code.OpPop),         // 0011
+				code.Make(code.OpJmp, 31),     // 0012
+				code.Make(code.OpEndTry),      // 0015
+				code.Make(code.OpConstant, 1), // 0016
+				code.Make(code.OpPop),         // 0019
+				code.Make(code.OpJmp, 28),     // 0020
+				code.Make(code.OpConstant, 2), // 0023
+				code.Make(code.OpPop),         // 0026
+				code.Make(code.OpRethrow),     // 0027
+				code.Make(code.OpJmp, 0),      // 0028
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestMatchExpressions(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             `match (1) { 1 => 2, _ => 3 }`,
+			expectedConstants: []interface{}{1, 1, 2, 3},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),  // 0000
+				code.Make(code.OpSetGlobal, 0), // 0003
+				code.Make(code.OpGetGlobal, 0), // 0006
+				code.Make(code.OpConstant, 1),  // 0009
+				code.Make(code.OpMatchLiteral), // 0012
+				code.Make(code.OpJNE, 22),      // 0013
+				code.Make(code.OpConstant, 2),  // 0016
+				code.Make(code.OpJmp, 32),      // 0019
+				code.Make(code.OpConstant, 3),  // 0022
+				code.Make(code.OpJmp, 32),      // 0025
+				code.Make(code.OpGetGlobal, 0), // 0028
+				code.Make(code.OpNoMatch),      // 0031
+				code.Make(code.OpPop),          // 0032
+			},
+		},
+		{
+			input:             `match ([1]) { [a, ...r] if (a) => r }`,
+			expectedConstants: []interface{}{1, 0},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),      // 0000
+				code.Make(code.OpArray, 1),         // 0003
+				code.Make(code.OpSetGlobal, 0),     // 0006
+				code.Make(code.OpGetGlobal, 0),     // 0009
+				code.Make(code.OpMatchArray, 1, 1), // 0012
+				code.Make(code.OpJNE, 50),          // 0016
+				code.Make(code.OpGetGlobal, 0),     // 0019
+				code.Make(code.OpConstant, 1),      // 0022
+				code.Make(code.OpIndex),            // 0025
+				code.Make(code.OpSetGlobal, 1),     // 0026
+				code.Make(code.OpGetGlobal, 0),     // 0029
+				code.Make(code.OpArrayRest, 1),     // 0032
+				code.Make(code.OpSetGlobal, 2),     // 0035
+				code.Make(code.OpGetGlobal, 1),     // 0038
+				code.Make(code.OpJNE, 50),          // 0041
+				code.Make(code.OpGetGlobal, 2),     // 0044
+				code.Make(code.OpJmp, 54),          // 0047
+				code.Make(code.OpGetGlobal, 0),     // 0050
+				code.Make(code.OpNoMatch),          // 0053
+				code.Make(code.OpPop),              // 0054
+			},
+		},
+		{
+			input:             `match ({}) { {"a": 1} => 2 }`,
+			expectedConstants: []interface{}{"a", "a", 1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpHash, 0),      // 0000
+				code.Make(code.OpSetGlobal, 0), // 0003
+				code.Make(code.OpGetGlobal, 0), // 0006
+				code.Make(code.OpConstant, 0),  // 0009
+				code.Make(code.OpMatchHash, 1), // 0012
+				code.Make(code.OpJNE, 38),      // 0015
+				code.Make(code.OpGetGlobal, 0), // 0018
+				code.Make(code.OpConstant, 1),  // 0021
+				code.Make(code.OpIndex),        // 0024
+				code.Make(code.OpConstant, 2),  // 0025
+				code.Make(code.OpMatchLiteral), // 0028
+				code.Make(code.OpJNE, 38),      // 0029
+				code.Make(code.OpConstant, 3),  // 0032
+				code.Make(code.OpJmp, 42),      // 0035
+				code.Make(code.OpGetGlobal, 0), // 0038
+				code.Make(code.OpNoMatch),      // 0041
+				code.Make(code.OpPop),          // 0042
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestFunctionsWithoutReturnValue(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: `fn() { }`,
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpReturn),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 0, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+	runCompilerTests(t, tests)
+}
+
+func TestLetStatementScopes(t *testing.T) {tests := []compilerTestCase{
+	{
+		input: `
+		let num = 55;
+		fn() { num }
+		`,
+		expectedConstants: []interface{}{
+			55,
 			[]code.Instructions{
 				code.Make(code.OpGetGlobal, 0),
 				code.Make(code.OpReturnValue),
@@ -502,7 +1132,7 @@ func TestLetStatementScopes(t *testing.T) {tests := []compilerTestCase{
 		expectedInstructions: []code.Instructions{
 			code.Make(code.OpConstant, 0),
 			code.Make(code.OpSetGlobal, 0),
-			code.Make(code.OpConstant, 1),
+			code.Make(code.OpClosure, 1, 0),
 			code.Make(code.OpPop),
 		},
 	},
@@ -523,7 +1153,7 @@ func TestLetStatementScopes(t *testing.T) {tests := []compilerTestCase{
 			},
 		},
 		expectedInstructions: []code.Instructions{
-			code.Make(code.OpConstant, 1),
+			code.Make(code.OpClosure, 1, 0),
 			code.Make(code.OpPop),
 		},
 	},
@@ -549,7 +1179,7 @@ func TestLetStatementScopes(t *testing.T) {tests := []compilerTestCase{
 			},
 		},
 		expectedInstructions: []code.Instructions{
-			code.Make(code.OpConstant, 2),
+			code.Make(code.OpClosure, 2, 0),
 			code.Make(code.OpPop),
 		},
 	},
@@ -620,7 +1250,7 @@ func TestFunctionCalls(t *testing.T) {
 				},
 			},
 			expectedInstructions: []code.Instructions{
-				code.Make(code.OpConstant, 1), // The compiled function
+				code.Make(code.OpClosure, 1, 0), // The compiled function
 				code.Make(code.OpCall, 0),
 				code.Make(code.OpPop),
 			},
@@ -638,7 +1268,7 @@ func TestFunctionCalls(t *testing.T) {
 				},
 			},
 			expectedInstructions: []code.Instructions{
-				code.Make(code.OpConstant, 1), // The compiled function
+				code.Make(code.OpClosure, 1, 0), // The compiled function
 				code.Make(code.OpSetGlobal, 0),
 				code.Make(code.OpGetGlobal, 0),
 				code.Make(code.OpCall, 0),
@@ -657,7 +1287,7 @@ func TestFunctionCalls(t *testing.T) {
 				24,
 			},
 			expectedInstructions: []code.Instructions{
-				code.Make(code.OpConstant, 0),
+				code.Make(code.OpClosure, 0, 0),
 				code.Make(code.OpSetGlobal, 0),
 				code.Make(code.OpGetGlobal, 0),
 				code.Make(code.OpConstant, 1),
@@ -684,7 +1314,7 @@ func TestFunctionCalls(t *testing.T) {
 				26,
 			},
 			expectedInstructions: []code.Instructions{
-				code.Make(code.OpConstant, 0),
+				code.Make(code.OpClosure, 0, 0),
 				code.Make(code.OpSetGlobal, 0),
 				code.Make(code.OpGetGlobal, 0),
 				code.Make(code.OpConstant, 1),
@@ -697,6 +1327,376 @@ func TestFunctionCalls(t *testing.T) {
 	}
 	runCompilerTests(t, tests)
 }
+func TestBuiltins(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: `
+			len([]);
+			append([], 1);
+			`,
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpGetBuiltin, 0),
+				code.Make(code.OpArray, 0),
+				code.Make(code.OpCall, 1),
+				code.Make(code.OpPop),
+				code.Make(code.OpGetBuiltin, 3),
+				code.Make(code.OpArray, 0),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpCall, 2),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: `fn() { len([]) }`,
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpGetBuiltin, 0),
+					code.Make(code.OpArray, 0),
+					code.Make(code.OpTailCall, 1),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 0, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+	runCompilerTests(t, tests)
+}
+
+func TestClosures(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: `
+			fn(a) {
+				fn(b) {
+					a + b
+				}
+			}
+			`,
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpGetFree, 0),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpAdd),
+					code.Make(code.OpReturnValue),
+				},
+				[]code.Instructions{
+					code.Make(code.OpCaptureLocal, 0),
+					code.Make(code.OpClosure, 0, 1),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: `
+			fn(a) {
+				fn(b) {
+					fn(c) {
+						a + b + c
+					}
+				}
+			};
+			`,
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpGetFree, 0),
+					code.Make(code.OpGetFree, 1),
+					code.Make(code.OpAdd),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpAdd),
+					code.Make(code.OpReturnValue),
+				},
+				[]code.Instructions{
+					code.Make(code.OpCaptureFree, 0),
+					code.Make(code.OpCaptureLocal, 0),
+					code.Make(code.OpClosure, 0, 2),
+					code.Make(code.OpReturnValue),
+				},
+				[]code.Instructions{
+					code.Make(code.OpCaptureLocal, 0),
+					code.Make(code.OpClosure, 1, 1),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 2, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: `
+			let global = 55;
+			fn() {
+				let a = 66;
+				fn() {
+					let b = 77;
+					fn() {
+						let c = 88;
+						global + a + b + c;
+					}
+				}
+			}
+			`,
+			expectedConstants: []interface{}{
+				55,
+				66,
+				77,
+				88,
+				[]code.Instructions{
+					code.Make(code.OpConstant, 3),
+					code.Make(code.OpSetLocal, 0),
+					code.Make(code.OpGetGlobal, 0),
+					code.Make(code.OpGetFree, 0),
+					code.Make(code.OpAdd),
+					code.Make(code.OpGetFree, 1),
+					code.Make(code.OpAdd),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpAdd),
+					code.Make(code.OpReturnValue),
+				},
+				[]code.Instructions{
+					code.Make(code.OpConstant, 2),
+					code.Make(code.OpSetLocal, 0),
+					code.Make(code.OpCaptureFree, 0),
+					code.Make(code.OpCaptureLocal, 0),
+					code.Make(code.OpClosure, 4, 2),
+					code.Make(code.OpReturnValue),
+				},
+				[]code.Instructions{
+					code.Make(code.OpConstant, 1),
+					code.Make(code.OpSetLocal, 0),
+					code.Make(code.OpCaptureLocal, 0),
+					code.Make(code.OpClosure, 5, 1),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpClosure, 6, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: `fn(a) { fn() { a = 1 } }`,
+			expectedConstants: []interface{}{
+				1,
+				[]code.Instructions{
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpSetFree, 0),
+					code.Make(code.OpGetFree, 0),
+					code.Make(code.OpReturnValue),
+				},
+				[]code.Instructions{
+					code.Make(code.OpCaptureLocal, 0),
+					code.Make(code.OpClosure, 1, 1),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 2, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+	runCompilerTests(t, tests)
+}
+
+func TestRecursiveFunctions(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: `
+			let countDown = fn(x) { countDown(x - 1); };
+			countDown(1);
+			`,
+			expectedConstants: []interface{}{
+				1,
+				[]code.Instructions{
+					code.Make(code.OpCurrentClosure),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpSub),
+					code.Make(code.OpTailCall, 1),
+					code.Make(code.OpReturnValue),
+				},
+				1,
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpCall, 1),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: `
+			let wrapper = fn() {
+				let countDown = fn(x) { countDown(x - 1); };
+				countDown(1);
+			};
+			wrapper();
+			`,
+			expectedConstants: []interface{}{
+				1,
+				[]code.Instructions{
+					code.Make(code.OpCurrentClosure),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpSub),
+					code.Make(code.OpTailCall, 1),
+					code.Make(code.OpReturnValue),
+				},
+				1,
+				[]code.Instructions{
+					code.Make(code.OpClosure, 1, 0),
+					code.Make(code.OpSetLocal, 0),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpConstant, 2),
+					code.Make(code.OpTailCall, 1),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 3, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpCall, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+	runCompilerTests(t, tests)
+}
+
+func TestTailCalls(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: `fn(f) { return f(1); }`,
+			expectedConstants: []interface{}{
+				1,
+				[]code.Instructions{
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpTailCall, 1),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: `fn(f) { f(1) + 1 }`,
+			expectedConstants: []interface{}{
+				1,
+				1,
+				[]code.Instructions{
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpCall, 1),
+					code.Make(code.OpConstant, 1),
+					code.Make(code.OpAdd),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 2, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: `fn(f) { if (f) { f(1) } else { 2 } }`,
+			expectedConstants: []interface{}{
+				1,
+				2,
+				[]code.Instructions{
+					code.Make(code.OpGetLocal, 0), // 0000
+					code.Make(code.OpJNE, 15),     // 0002
+					code.Make(code.OpGetLocal, 0), // 0005
+					code.Make(code.OpConstant, 0), // 0007
+					code.Make(code.OpTailCall, 1), // 0010
+					code.Make(code.OpJmp, 18),     // 0012
+					code.Make(code.OpConstant, 1), // 0015
+					code.Make(code.OpReturnValue), // 0018
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 2, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: `fn(f) { try { return f(1); } catch (e) { 2 } }`,
+			expectedConstants: []interface{}{
+				1,
+				2,
+				[]code.Instructions{
+					code.Make(code.OpTry, 16),     // 0000
+					code.Make(code.OpGetLocal, 0), // 0003
+					code.Make(code.OpConstant, 0), // 0005
+					code.Make(code.OpCall, 1),     // 0008
+					code.Make(code.OpEndTry),      // 0010
+					code.Make(code.OpReturnValue), // 0011
+					code.Make(code.OpEndTry),      // 0012
+					code.Make(code.OpJmp, 25),     // 0013
+					code.Make(code.OpSetLocal, 1), // 0016
+					code.Make(code.OpConstant, 1), // 0018
+					code.Make(code.OpPop),         // 0021
+					code.Make(code.OpJmp, 25),     // 0022
+					code.Make(code.OpReturn),      // 0025
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 2, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestCompilerErrorPositions(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedError string
+	}{
+		{"let a = 1;\n a + b", "2:6: undefined variable b"},
+		{"fn() {\n  let x = y;\n}", "2:11: undefined variable y"},
+		{"x = 1", "1:1: cannot assign to undefined variable x"},
+		{"let f = fn() { fn() { f = 1 } }", "1:23: cannot assign to function name f"},
+		{"len = 1", "1:1: cannot assign to builtin len"},
+		{"let f = fn() { f = 1 }", "1:16: cannot assign to function name f"},
+		{"match ([1, 2]) { [a, 3] => 0, _ => a }", "1:36: undefined variable a"},
+		{"fn() { match (1) { a => a }; a }", "1:30: undefined variable a"},
+	}
+
+	for _, tt := range tests {
+		program := parse(tt.input)
+
+		compiler := New_Compiler()
+		err := compiler.Compile(program)
+		if err == nil {
+			t.Errorf("expected compiler error for %q, got none", tt.input)
+			continue
+		}
+
+		if err.Error() != tt.expectedError {
+			t.Errorf("wrong compiler error. want=%q, got=%q", tt.expectedError, err.Error())
+		}
+	}
+}
+
 func runCompilerTests(t *testing.T, tests []compilerTestCase) {
 	t.Helper()
 
@@ -749,6 +1749,11 @@ func testConstants(expected []interface{}, actual []object.Object) error {
 			if err != nil {
 				return err
 			}
+		case float64:
+			err := testFloatObject(constant, actual[i])
+			if err != nil {
+				return fmt.Errorf("constant %d - testFloatObject failed: %s", i, err)
+			}
 		case string:
 			err := testStringObject(constant, actual[i])
 			if err != nil {
@@ -770,6 +1775,19 @@ func testConstants(expected []interface{}, actual []object.Object) error {
 	return nil
 }
 
+func testFloatObject(expected float64, actual object.Object) error {
+	result, ok := actual.(*object.Float)
+	if !ok {
+		return fmt.Errorf("object is not Float. got=%T (%+v)", actual, actual)
+	}
+
+	if result.Value != expected {
+		return fmt.Errorf("object has wrong value. got=%g, want=%g", result.Value, expected)
+	}
+
+	return nil
+}
+
 func testStringObject(expected string, actual object.Object) error {
 	result, ok := actual.(*object.String)
 	if !ok {
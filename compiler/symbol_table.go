@@ -5,6 +5,9 @@ type SymScope string
 const (
     GlobalScope SymScope = "GLOBAL"
     LocalScope SymScope = "LOCAL"
+    FreeScope SymScope = "FREE"
+    BuiltinScope SymScope = "BUILTIN"
+    FunctionScope SymScope = "FUNCTION" // the closure currently being executed
 )
 
 type Symbol struct {
@@ -17,16 +20,36 @@ type SymTable struct {
     Outer *SymTable
     store map[string]Symbol
     num_def int
+    globals *globalScope
+
+    FreeSymbols []Symbol // the original symbols of the enclosing scopes captured by this one
+}
+
+// globalScope is shared by the top level of a program and the top levels of the modules it
+// imports, their globals all live in the same globals of the vm
+type globalScope struct {
+    count int
+    modules map[string]compiledModule // by resolved path, so a module is only compiled once
 }
 
 func NewSymTable() *SymTable {
     m := make(map[string]Symbol)
-    return &SymTable{store: m, num_def: 0}
+    free := []Symbol{}
+    globals := &globalScope{modules: map[string]compiledModule{}}
+    return &SymTable{store: m, num_def: 0, globals: globals, FreeSymbols: free}
 }
 
 func NewEnclosedSymTable(outer *SymTable) *SymTable {
     s := NewSymTable()
     s.Outer = outer
+    s.globals = outer.globals
+    return s
+}
+
+// NewModuleSymTable is the top level of an imported module, its globals come after the importer's
+func NewModuleSymTable(importer *SymTable) *SymTable {
+    s := NewSymTable()
+    s.globals = importer.globals
     return s
 }
 
@@ -34,6 +57,8 @@ func (s *SymTable) Define(name string) Symbol {
     symbol := Symbol{Name: name, Index: s.num_def}
     if s.Outer == nil {
         symbol.Scope = GlobalScope
+        symbol.Index = s.globals.count
+        s.globals.count++
     } else {
         symbol.Scope = LocalScope
     }
@@ -43,11 +68,74 @@ func (s *SymTable) Define(name string) Symbol {
     return symbol
 }
 
+func (s *SymTable) DefineBuiltin(index int, name string) Symbol {
+    symbol := Symbol{Name: name, Scope: BuiltinScope, Index: index}
+    s.store[name] = symbol
+    return symbol
+}
+
+// the function's own name, so its body can refer to itself without capturing anything
+func (s *SymTable) DefineFunctionName(name string) Symbol {
+    symbol := Symbol{Name: name, Scope: FunctionScope, Index: 0}
+    s.store[name] = symbol
+    return symbol
+}
+
+func (s *SymTable) defineFree(original Symbol) Symbol {
+    s.FreeSymbols = append(s.FreeSymbols, original)
+
+    symbol := Symbol{Name: original.Name, Index: len(s.FreeSymbols) - 1}
+    symbol.Scope = FreeScope
+
+    s.store[original.Name] = symbol
+    return symbol
+}
+
+// shadow lets the names be defined again for a while, calling the returned func puts back
+// whatever they meant before
+func (s *SymTable) shadow(names []string) func() {
+    saved := map[string]Symbol{}
+    for _, name := range names {
+        if symbol, ok := s.store[name]; ok {
+            saved[name] = symbol
+        }
+    }
+
+    return func() {
+        for _, name := range names {
+            if symbol, ok := saved[name]; ok {
+                s.store[name] = symbol
+            } else {
+                delete(s.store, name)
+            }
+        }
+    }
+}
+
+// capturedFrom is the scope a free symbol was defined in, out through the functions in between
+func (s *SymTable) capturedFrom(symbol Symbol) SymScope {
+    for symbol.Scope == FreeScope {
+        symbol = s.FreeSymbols[symbol.Index]
+        s = s.Outer
+    }
+    return symbol.Scope
+}
+
 func (s *SymTable) Resolve(name string) (Symbol, bool) {
     sym, ok := s.store[name]
     if !ok && s.Outer != nil {
         sym, ok = s.Outer.Resolve(name)
-        return sym, ok
+        if !ok {
+            return sym, ok
+        }
+
+        if sym.Scope == GlobalScope || sym.Scope == BuiltinScope {
+            return sym, ok
+        }
+
+        // a local of some enclosing function; we capture it as a free variable
+        free := s.defineFree(sym)
+        return free, true
     }
     return sym, ok
 }
@@ -137,3 +137,172 @@ func TestResolveNestedLocal(t *testing.T) {
         }
     }
 }
+
+func TestResolveFree(t *testing.T) {
+    global := NewSymTable()
+    global.Define("a")
+    global.Define("b")
+    firstLocal := NewEnclosedSymTable(global)
+    firstLocal.Define("c")
+    firstLocal.Define("d")
+    secondLocal := NewEnclosedSymTable(firstLocal)
+    secondLocal.Define("e")
+    secondLocal.Define("f")
+    tests := []struct {
+        table *SymTable
+        expectedSymbols []Symbol
+        expectedFreeSymbols []Symbol
+    }{
+        {
+            firstLocal,
+            []Symbol{
+                Symbol{Name: "a", Scope: GlobalScope, Index: 0},
+                Symbol{Name: "b", Scope: GlobalScope, Index: 1},
+                Symbol{Name: "c", Scope: LocalScope, Index: 0},
+                Symbol{Name: "d", Scope: LocalScope, Index: 1},
+            },
+            []Symbol{},
+        },
+        {
+            secondLocal,
+            []Symbol{
+                Symbol{Name: "a", Scope: GlobalScope, Index: 0},
+                Symbol{Name: "b", Scope: GlobalScope, Index: 1},
+                Symbol{Name: "c", Scope: FreeScope, Index: 0},
+                Symbol{Name: "d", Scope: FreeScope, Index: 1},
+                Symbol{Name: "e", Scope: LocalScope, Index: 0},
+                Symbol{Name: "f", Scope: LocalScope, Index: 1},
+            },
+            []Symbol{
+                Symbol{Name: "c", Scope: LocalScope, Index: 0},
+                Symbol{Name: "d", Scope: LocalScope, Index: 1},
+            },
+        },
+    }
+    for _, tt := range tests {
+        for _, sym := range tt.expectedSymbols {
+            result, ok := tt.table.Resolve(sym.Name)
+            if !ok {
+                t.Errorf("name %s not resolvable", sym.Name)
+                continue
+            }
+            if result != sym {
+                t.Errorf("expected %s to resolve to %+v, got=%+v",
+                    sym.Name, sym, result)
+            }
+        }
+
+        if len(tt.table.FreeSymbols) != len(tt.expectedFreeSymbols) {
+            t.Errorf("wrong number of free symbols. got=%d, want=%d",
+                len(tt.table.FreeSymbols), len(tt.expectedFreeSymbols))
+            continue
+        }
+
+        for i, sym := range tt.expectedFreeSymbols {
+            result := tt.table.FreeSymbols[i]
+            if result != sym {
+                t.Errorf("wrong free symbol. got=%+v, want=%+v", result, sym)
+            }
+        }
+    }
+}
+
+func TestResolveUnresolvableFree(t *testing.T) {
+    global := NewSymTable()
+    global.Define("a")
+    firstLocal := NewEnclosedSymTable(global)
+    firstLocal.Define("c")
+    secondLocal := NewEnclosedSymTable(firstLocal)
+    secondLocal.Define("e")
+    secondLocal.Define("f")
+
+    expected := []Symbol{
+        Symbol{Name: "a", Scope: GlobalScope, Index: 0},
+        Symbol{Name: "c", Scope: FreeScope, Index: 0},
+        Symbol{Name: "e", Scope: LocalScope, Index: 0},
+        Symbol{Name: "f", Scope: LocalScope, Index: 1},
+    }
+    for _, sym := range expected {
+        result, ok := secondLocal.Resolve(sym.Name)
+        if !ok {
+            t.Errorf("name %s not resolvable", sym.Name)
+            continue
+        }
+        if result != sym {
+            t.Errorf("expected %s to resolve to %+v, got=%+v",
+                sym.Name, sym, result)
+        }
+    }
+
+    expectedUnresolvable := []string{"b", "d"}
+    for _, name := range expectedUnresolvable {
+        _, ok := secondLocal.Resolve(name)
+        if ok {
+            t.Errorf("name %s resolved, but was expected not to", name)
+        }
+    }
+}
+
+func TestDefineResolveBuiltins(t *testing.T) {
+    global := NewSymTable()
+    firstLocal := NewEnclosedSymTable(global)
+    secondLocal := NewEnclosedSymTable(firstLocal)
+
+    expected := []Symbol{
+        Symbol{Name: "a", Scope: BuiltinScope, Index: 0},
+        Symbol{Name: "c", Scope: BuiltinScope, Index: 1},
+        Symbol{Name: "e", Scope: BuiltinScope, Index: 2},
+        Symbol{Name: "f", Scope: BuiltinScope, Index: 3},
+    }
+
+    for i, v := range expected {
+        global.DefineBuiltin(i, v.Name)
+    }
+
+    for _, table := range []*SymTable{global, firstLocal, secondLocal} {
+        for _, sym := range expected {
+            result, ok := table.Resolve(sym.Name)
+            if !ok {
+                t.Errorf("name %s not resolvable", sym.Name)
+                continue
+            }
+            if result != sym {
+                t.Errorf("expected %s to resolve to %+v, got=%+v",
+                    sym.Name, sym, result)
+            }
+        }
+    }
+}
+
+func TestDefineAndResolveFunctionName(t *testing.T) {
+    global := NewSymTable()
+    global.DefineFunctionName("a")
+
+    expected := Symbol{Name: "a", Scope: FunctionScope, Index: 0}
+
+    result, ok := global.Resolve(expected.Name)
+    if !ok {
+        t.Fatalf("function name %s not resolvable", expected.Name)
+    }
+
+    if result != expected {
+        t.Errorf("expected %s to resolve to %+v, got=%+v", expected.Name, expected, result)
+    }
+}
+
+func TestShadowingFunctionName(t *testing.T) {
+    global := NewSymTable()
+    global.DefineFunctionName("a")
+    global.Define("a")
+
+    expected := Symbol{Name: "a", Scope: GlobalScope, Index: 0}
+
+    result, ok := global.Resolve(expected.Name)
+    if !ok {
+        t.Fatalf("function name %s not resolvable", expected.Name)
+    }
+
+    if result != expected {
+        t.Errorf("expected %s to resolve to %+v, got=%+v", expected.Name, expected, result)
+    }
+}
@@ -2,17 +2,33 @@ package evaluator
 
 import (
     "fmt"
+    "math"
     "monkey/ast"
+    "monkey/module"
     "monkey/object"
+    "strings"
 )
 
 var (
     NULL = &object.Null{}
     TRUE = &object.Boolean{Value: true}
     FALSE = &object.Boolean{Value: false}
+    BREAK = &object.Break{}
+    CONTINUE = &object.Continue{}
 )
 
 func Eval(node ast.Node, env *object.Environment) object.Object {
+    result := evalNode(node, env)
+
+    // the innermost node that produced the error gets to claim it
+    if err, ok := result.(*object.Error); ok && !err.Pos.IsValid() && node != nil {
+        err.Pos = node.Pos()
+    }
+
+    return result
+}
+
+func evalNode(node ast.Node, env *object.Environment) object.Object {
     switch node := node.(type) {
         case *ast.Program:
             return evalProgram(node, env)
@@ -25,10 +41,17 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
             if isError(value) {
                 return value
             }
+            if node.Pattern != nil {
+                return evalDestructuring(node.Pattern, value, env)
+            }
             env.Set(node.Name.Value, value)
             return value
         case *ast.IntegerLiteral:
             return &object.Integer{Value: node.Value}
+        case *ast.FloatLiteral:
+            return &object.Float{Value: node.Value}
+        case *ast.InterpolatedString:
+            return evalInterpolatedString(node, env)
         case *ast.StringLiteral:
             return &object.String{Value: node.Value}
         case *ast.Boolean:
@@ -40,6 +63,10 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
             }
             return evalPrefixExpression(node.Operator, right)
         case *ast.InfixExpression:
+            if node.Operator == "&&" || node.Operator == "||" {
+                return evalLogicalExpression(node, env)
+            }
+
             left := Eval(node.Left, env)
             if isError(left) {
                 return left
@@ -52,6 +79,25 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
             return evalInfixExpression(node.Operator, left, right)
         case *ast.IfExpression:
             return evalIfExpression(node, env)
+        case *ast.MatchExpression:
+            return evalMatchExpression(node, env)
+        case *ast.WhileStatement:
+            return evalWhileStatement(node, env)
+        case *ast.ForStatement:
+            return evalForStatement(node, env)
+        case *ast.BreakStatement:
+            return BREAK
+        case *ast.ContinueStatement:
+            return CONTINUE
+        case *ast.TryStatement:
+            return evalTryStatement(node, env)
+        case *ast.ThrowStatement:
+            value := Eval(node.Value, env)
+            if isError(value) {
+                return value
+            }
+            message, pos := object.UncaughtException(value, node.Pos())
+            return &object.Error{Message: message, Pos: pos, Thrown: value}
         case *ast.ReturnStatement:
             value := Eval(node.ReturnValue, env)
             if isError(value) {
@@ -60,10 +106,12 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
             return &object.ReturnValue{Value: value}
         case *ast.Identifier:
             return evalIdentifier(node, env)
+        case *ast.ImportExpression:
+            return evalImport(node, env)
         case *ast.FunctionLiteral:
             params := node.Parameters
             body := node.Body
-            return &object.Function{Parameters: params, Env: env, Body: body}
+            return &object.Function{Parameters: params, Defaults: node.Defaults, Rest: node.Rest, Env: env, Body: body, Name: node.Name}
         case *ast.CallExpression:
             function := Eval(node.Function, env)
             if isError(function) {
@@ -97,6 +145,8 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
             return evalIndexExpression(left, index)
         case *ast.HashLiteral:
             return evalHashLiteral(node, env)
+        case *ast.AssignExpression:
+            return evalAssignExpression(node, env)
     }
 
     return NULL
@@ -127,7 +177,8 @@ func evalBlockStatement(block *ast.BlockStatement, env *object.Environment) obje
 
         if res != nil {
             resType := res.Type()
-            if resType == object.RETURN_VALUE_OBJ || resType == object.ERROR_OBJ {
+            if resType == object.RETURN_VALUE_OBJ || resType == object.ERROR_OBJ ||
+                resType == object.BREAK_OBJ || resType == object.CONTINUE_OBJ {
                 return res
             }
         }
@@ -149,6 +200,11 @@ func evalPrefixExpression(operator string, right object.Object) object.Object {
             return evalBangOperatorExpression(right)
         case "-":
             return evalMinusPrefixOperatorExpression(right)
+        case "~":
+            if right.Type() != object.INTEGER_OBJ {
+                return newError("unknown operator: ~%s", right.Type())
+            }
+            return &object.Integer{Value: ^right.(*object.Integer).Value}
         default:
             return newError("unknown operator: %s%s", operator, right.Type())
     }
@@ -172,18 +228,22 @@ func evalBangOperatorExpression(right object.Object) object.Object {
 }
 
 func evalMinusPrefixOperatorExpression(right object.Object) object.Object {
-    if right.Type() != object.INTEGER_OBJ {
+    switch right := right.(type) {
+    case *object.Integer:
+        return &object.Integer{Value: -right.Value}
+    case *object.Float:
+        return &object.Float{Value: -right.Value}
+    default:
         return newError("unknown operator: -%s", right.Type())
     }
-
-    value := right.(*object.Integer).Value
-    return &object.Integer{Value: -value}
 }
 
 func evalInfixExpression(operator string, left, right object.Object) object.Object {
     switch {
     case left.Type() == object.INTEGER_OBJ && right.Type() == object.INTEGER_OBJ :
         return evalIntegerInfixExpression(operator, left, right)
+    case isNumber(left) && isNumber(right): // at least one of them is a float
+        return evalFloatInfixExpression(operator, left, right)
     case left.Type() == object.BOOLEAN_OBJ && right.Type() == object.BOOLEAN_OBJ:
         return evalBooleanInfixExpression(operator, left, right)
     case left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ:
@@ -195,6 +255,21 @@ func evalInfixExpression(operator string, left, right object.Object) object.Obje
     }
 }
 
+// the right side is only evaluated if the left one doesn't decide the result,
+// the result is whichever operand decided it
+func evalLogicalExpression(node *ast.InfixExpression, env *object.Environment) object.Object {
+    left := Eval(node.Left, env)
+    if isError(left) {
+        return left
+    }
+
+    if node.Operator == "&&" && !isTruthy(left) || node.Operator == "||" && isTruthy(left) {
+        return left
+    }
+
+    return Eval(node.Right, env)
+}
+
 func evalIntegerInfixExpression(operator string, left, right object.Object) object.Object {
     leftVal := left.(*object.Integer).Value
     rightVal := right.(*object.Integer).Value
@@ -207,11 +282,37 @@ func evalIntegerInfixExpression(operator string, left, right object.Object) obje
     case "*":
         return &object.Integer{Value: leftVal * rightVal}
     case "/":
+        if rightVal == 0 {
+            return newError("division by zero")
+        }
         return &object.Integer{Value: leftVal / rightVal}
+    case "%":
+        if rightVal == 0 {
+            return newError("modulo by zero")
+        }
+        return &object.Integer{Value: leftVal % rightVal}
+    case "&":
+        return &object.Integer{Value: leftVal & rightVal}
+    case "|":
+        return &object.Integer{Value: leftVal | rightVal}
+    case "^":
+        return &object.Integer{Value: leftVal ^ rightVal}
+    case "<<", ">>":
+        if rightVal < 0 {
+            return newError("negative shift count: %d", rightVal)
+        }
+        if operator == "<<" {
+            return &object.Integer{Value: leftVal << rightVal}
+        }
+        return &object.Integer{Value: leftVal >> rightVal}
     case "<":
         return nativeBoolToBooleanObject(leftVal < rightVal) // pointer comparison
     case ">":
         return nativeBoolToBooleanObject(leftVal > rightVal) // pointer comparison
+    case "<=":
+        return nativeBoolToBooleanObject(leftVal <= rightVal)
+    case ">=":
+        return nativeBoolToBooleanObject(leftVal >= rightVal)
     case "==":
         return nativeBoolToBooleanObject(leftVal == rightVal) // pointer comparison
     case "!=":
@@ -221,6 +322,45 @@ func evalIntegerInfixExpression(operator string, left, right object.Object) obje
     }
 }
 
+// integers are promoted to floats when mixed with them. floats follow IEEE 754, so
+// dividing by zero gives an infinity instead of an error
+func evalFloatInfixExpression(operator string, left, right object.Object) object.Object {
+    leftVal, _ := object.ToFloat(left)
+    rightVal, _ := object.ToFloat(right)
+
+    switch operator {
+    case "+":
+        return &object.Float{Value: leftVal + rightVal}
+    case "-":
+        return &object.Float{Value: leftVal - rightVal}
+    case "*":
+        return &object.Float{Value: leftVal * rightVal}
+    case "/":
+        return &object.Float{Value: leftVal / rightVal}
+    case "%":
+        return &object.Float{Value: math.Mod(leftVal, rightVal)}
+    case "<":
+        return nativeBoolToBooleanObject(leftVal < rightVal)
+    case ">":
+        return nativeBoolToBooleanObject(leftVal > rightVal)
+    case "<=":
+        return nativeBoolToBooleanObject(leftVal <= rightVal)
+    case ">=":
+        return nativeBoolToBooleanObject(leftVal >= rightVal)
+    case "==":
+        return nativeBoolToBooleanObject(leftVal == rightVal)
+    case "!=":
+        return nativeBoolToBooleanObject(leftVal != rightVal)
+    default:
+        return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+    }
+}
+
+func isNumber(obj object.Object) bool {
+    _, ok := object.ToFloat(obj)
+    return ok
+}
+
 func evalStringInfixExpression(operator string, left, right object.Object) object.Object {
     if operator != "+" {
         return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
@@ -259,7 +399,13 @@ func evalIfExpression(ie *ast.IfExpression, env *object.Environment) object.Obje
         return cons
     }
     for _, alt := range ie.Alternative {
-        return evalIfExpression(alt, env)
+        altCondition := Eval(alt.Condition, env)
+        if isError(altCondition) {
+            return altCondition
+        }
+        if isTruthy(altCondition) {
+            return Eval(alt.Consequence, env)
+        }
     }
     if ie.Default != nil {
         defEvalueated := Eval(ie.Default, env)
@@ -272,6 +418,276 @@ func evalIfExpression(ie *ast.IfExpression, env *object.Environment) object.Obje
     }
 }
 
+// the arms are tried in order, the first one whose pattern fits and whose guard holds gives the value
+func evalMatchExpression(me *ast.MatchExpression, env *object.Environment) object.Object {
+    subject := Eval(me.Subject, env)
+    if isError(subject) {
+        return subject
+    }
+
+    for _, arm := range me.Arms {
+        // the names a pattern binds only exist inside its arm
+        armEnv := object.NewEnclosedEnvironment(env)
+
+        matched, errObj := matchPattern(arm.Pattern, subject, armEnv)
+        if errObj != nil {
+            return errObj
+        }
+        if !matched {
+            continue
+        }
+
+        if arm.Guard != nil {
+            guard := Eval(arm.Guard, armEnv)
+            if isError(guard) {
+                return guard
+            }
+            if !isTruthy(guard) {
+                continue
+            }
+        }
+
+        return Eval(arm.Value, armEnv)
+    }
+
+    return newError("%s", object.NoMatch(subject))
+}
+
+// matchPattern reports whether the value fits the pattern, binding the pattern's names as it goes
+func matchPattern(pattern ast.MatchPattern, value object.Object, env *object.Environment) (bool, *object.Error) {
+    switch pattern := pattern.(type) {
+    case *ast.WildcardPattern:
+        return true, nil
+    case *ast.BindingPattern:
+        env.Set(pattern.Name.Value, value)
+        return true, nil
+    case *ast.LiteralPattern:
+        literal := Eval(pattern.Value, env)
+        if errObj, ok := literal.(*object.Error); ok {
+            return false, errObj
+        }
+        return object.Equal(value, literal), nil
+    case *ast.ArrayMatchPattern:
+        if !object.MatchArray(value, len(pattern.Elements), pattern.Rest != nil) {
+            return false, nil
+        }
+
+        elements := value.(*object.Array).Elements
+        for i, element := range pattern.Elements {
+            matched, errObj := matchPattern(element, elements[i], env)
+            if !matched || errObj != nil {
+                return false, errObj
+            }
+        }
+
+        if pattern.Rest != nil && pattern.Rest.Value != "_" {
+            values, _ := object.UnpackArray(value, len(pattern.Elements), true)
+            env.Set(pattern.Rest.Value, values[len(pattern.Elements)])
+        }
+        return true, nil
+    case *ast.HashMatchPattern:
+        keys := []object.Object{}
+        for _, key := range pattern.Keys {
+            evaluated := Eval(key, env)
+            if errObj, ok := evaluated.(*object.Error); ok {
+                return false, errObj
+            }
+            keys = append(keys, evaluated)
+        }
+        if !object.MatchHash(value, keys) {
+            return false, nil
+        }
+
+        hash := value.(*object.HashMap)
+        for i, key := range keys {
+            matched, errObj := matchPattern(pattern.Values[i], hash.Pairs[key.(object.Hashable).HashKey()].Value, env)
+            if !matched || errObj != nil {
+                return false, errObj
+            }
+        }
+        return true, nil
+    }
+
+    return false, nil
+}
+
+func evalWhileStatement(ws *ast.WhileStatement, env *object.Environment) object.Object {
+    for {
+        condition := Eval(ws.Condition, env)
+        if isError(condition) {
+            return condition
+        }
+        if !isTruthy(condition) {
+            return NULL
+        }
+
+        res := Eval(ws.Body, env)
+        switch res {
+        case BREAK:
+            return NULL
+        case CONTINUE:
+            continue
+        }
+
+        if res != nil {
+            resType := res.Type()
+            if resType == object.RETURN_VALUE_OBJ || resType == object.ERROR_OBJ {
+                return res
+            }
+        }
+    }
+}
+
+// binds the names of a let [a, ...rest] or let {a, b} pattern, nothing is bound if the shape is wrong
+func evalDestructuring(pattern ast.Pattern, value object.Object, env *object.Environment) object.Object {
+    var names []*ast.Identifier
+    var values []object.Object
+    var err error
+
+    switch pattern := pattern.(type) {
+    case *ast.ArrayPattern:
+        names = pattern.Elements
+        if pattern.Rest != nil {
+            names = append(names[:len(names):len(names)], pattern.Rest)
+        }
+        values, err = object.UnpackArray(value, len(pattern.Elements), pattern.Rest != nil)
+    case *ast.HashPattern:
+        names = pattern.Keys
+        keys := []string{}
+        for _, key := range pattern.Keys {
+            keys = append(keys, key.Value)
+        }
+        values, err = object.UnpackHash(value, keys)
+    }
+
+    if err != nil {
+        return newError("%s", err)
+    }
+
+    for i, name := range names {
+        env.Set(name.Value, values[i])
+    }
+
+    return value
+}
+
+// a module is evaluated in a scope of its own the first time it's imported, later imports get the same namespace
+func evalImport(node *ast.ImportExpression, env *object.Environment) object.Object {
+    path := module.Resolve(node.Path, node.Pos())
+    cache := env.Modules()
+
+    if mod, ok := cache.Loaded[path]; ok {
+        return mod
+    }
+
+    err := cache.Loading.Enter(node.Pos(), path)
+    if err != nil {
+        return newError("%s", err)
+    }
+    defer cache.Loading.Leave()
+
+    program, err := module.Parse(path)
+    if err != nil {
+        return newError("%s", err)
+    }
+
+    moduleEnv := object.NewModuleEnvironment(env)
+    result := Eval(program, moduleEnv)
+    if isError(result) {
+        return result
+    }
+
+    mod := &object.Module{Path: path, Exports: map[string]object.Object{}}
+    for _, name := range program.Exports() {
+        mod.Exports[name.Value], _ = moduleEnv.Get(name.Value)
+    }
+    cache.Loaded[path] = mod
+
+    return mod
+}
+
+// an error in the try block goes to the catch, the finally runs however the try and catch blocks are left.
+// a finally that errors, returns, breaks or continues itself wins over whatever the blocks before it did.
+func evalTryStatement(ts *ast.TryStatement, env *object.Environment) object.Object {
+    result := Eval(ts.Body, env)
+
+    if errObj, ok := result.(*object.Error); ok && ts.Catch != nil {
+        exception := errObj.Thrown
+        if exception == nil {
+            exception = object.NewException(errObj.Message, errObj.Pos)
+        }
+
+        env.Set(ts.CatchParam.Value, exception)
+        result = Eval(ts.Catch, env)
+    }
+
+    if ts.Finally != nil {
+        finally := Eval(ts.Finally, env)
+        if isControl(finally) {
+            return finally
+        }
+    }
+
+    if isControl(result) {
+        return result
+    }
+    return NULL
+}
+
+// errors, returns, breaks and continues all stop the statements around them
+func isControl(obj object.Object) bool {
+    if obj == nil {
+        return false
+    }
+
+    switch obj.Type() {
+    case object.ERROR_OBJ, object.RETURN_VALUE_OBJ, object.BREAK_OBJ, object.CONTINUE_OBJ:
+        return true
+    }
+    return false
+}
+
+func evalForStatement(fs *ast.ForStatement, env *object.Environment) object.Object {
+    collection := Eval(fs.Iterable, env)
+    if isError(collection) {
+        return collection
+    }
+
+    iter, ok := object.NewIterator(collection)
+    if !ok {
+        return newError("cannot iterate over %s", collection.Type())
+    }
+
+    for {
+        key, value, ok := iter.Next()
+        if !ok {
+            return NULL
+        }
+
+        if fs.Key != nil {
+            env.Set(fs.Key.Value, key)
+            env.Set(fs.Value.Value, value)
+        } else {
+            env.Set(fs.Value.Value, iter.Single(key, value))
+        }
+
+        res := Eval(fs.Body, env)
+        switch res {
+        case BREAK:
+            return NULL
+        case CONTINUE:
+            continue
+        }
+
+        if res != nil {
+            resType := res.Type()
+            if resType == object.RETURN_VALUE_OBJ || resType == object.ERROR_OBJ {
+                return res
+            }
+        }
+    }
+}
+
 func evalIdentifier(node *ast.Identifier, env *object.Environment) object.Object {
     if val, ok := env.Get(node.Value); ok {
         return val
@@ -303,8 +719,16 @@ func evalIndexExpression(left, index object.Object) object.Object {
     switch {
     case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
         return evalArrayIndexExpression(left, index)
+    case left.Type() == object.STRING_OBJ && index.Type() == object.INTEGER_OBJ:
+        return evalStringIndexExpression(left, index)
     case left.Type() == object.HASHMAP_OBJ:
         return evalHashMapIndexExpression(left, index)
+    case left.Type() == object.MODULE_OBJ:
+        value, err := left.(*object.Module).Member(index)
+        if err != nil {
+            return newError("%s", err)
+        }
+        return value
     default:
         return newError("index operator not supported: %s", left.Type())
     }
@@ -322,6 +746,18 @@ func evalArrayIndexExpression(array, index object.Object) object.Object {
     return arrayObject.Elements[idx]
 }
 
+// strings are indexed by character, not by byte
+func evalStringIndexExpression(str, index object.Object) object.Object {
+    chars := []rune(str.(*object.String).Value)
+    idx := index.(*object.Integer).Value
+
+    if idx < 0 || idx >= int64(len(chars)) {
+        return NULL
+    }
+
+    return &object.String{Value: string(chars[idx])}
+}
+
 func evalHashMapIndexExpression(hash, index object.Object) object.Object {
     hashMapObject := hash.(*object.HashMap)
 
@@ -338,6 +774,89 @@ func evalHashMapIndexExpression(hash, index object.Object) object.Object {
     return pair.Value
 }
 
+func evalAssignExpression(node *ast.AssignExpression, env *object.Environment) object.Object {
+    switch target := node.Target.(type) {
+    case *ast.Identifier:
+        value := Eval(node.Value, env)
+        if isError(value) {
+            return value
+        }
+
+        // the same errors the compiler gives
+        if env.IsFunctionName(target.Value) {
+            return newError("cannot assign to function name %s", target.Value)
+        }
+        if _, ok := env.Assign(target.Value, value); !ok {
+            if _, ok := builtins[target.Value]; ok {
+                return newError("cannot assign to builtin %s", target.Value)
+            }
+            return newError("cannot assign to undefined variable %s", target.Value)
+        }
+
+        return value
+    case *ast.IndexExpression:
+        left := Eval(target.Left, env)
+        if isError(left) {
+            return left
+        }
+
+        index := Eval(target.Index, env)
+        if isError(index) {
+            return index
+        }
+
+        value := Eval(node.Value, env)
+        if isError(value) {
+            return value
+        }
+
+        return evalIndexAssignment(left, index, value)
+    default:
+        return newError("cannot assign to %s", node.Target.String())
+    }
+}
+
+func evalIndexAssignment(left, index, value object.Object) object.Object {
+    switch left := left.(type) {
+    case *object.Array:
+        idx, ok := index.(*object.Integer)
+        if !ok {
+            return newError("array index must be INTEGER, got %s", index.Type())
+        }
+
+        if idx.Value < 0 || idx.Value >= int64(len(left.Elements)) {
+            return newError("index out of range: %d", idx.Value)
+        }
+
+        left.Elements[idx.Value] = value
+        return value
+    case *object.HashMap:
+        key, ok := index.(object.Hashable)
+        if !ok {
+            return newError("unusable as hash key: %s", index.Type())
+        }
+
+        left.Pairs[key.HashKey()] = object.HashPair{Key: index, Value: value}
+        return value
+    default:
+        return newError("index assignment not supported: %s", left.Type())
+    }
+}
+
+func evalInterpolatedString(node *ast.InterpolatedString, env *object.Environment) object.Object {
+    var out strings.Builder
+
+    for _, part := range node.Parts {
+        value := Eval(part, env)
+        if isError(value) {
+            return value
+        }
+        out.WriteString(object.Display(value))
+    }
+
+    return &object.String{Value: out.String()}
+}
+
 func evalHashLiteral(hashLitral *ast.HashLiteral, env *object.Environment) object.Object {
     pairs := make(map[object.HashKey]object.HashPair)
 
@@ -368,24 +887,57 @@ func evalHashLiteral(hashLitral *ast.HashLiteral, env *object.Environment) objec
 func applyFunction(function object.Object, args []object.Object) object.Object {
     switch fn := function.(type) {
     case *object.Function:
-        extendedEnv := extendFunctionEnv(fn, args)
+        extendedEnv, errObj := extendFunctionEnv(fn, args)
+        if errObj != nil {
+            return errObj
+        }
         evaluated := Eval(fn.Body, extendedEnv)
         return unwrapReturnValue(evaluated)
     case *object.Builtin:
-        return fn.Fn(args...)
+        if result := fn.Fn(args...); result != nil {
+            return result
+        }
+        return NULL
     default:
         return newError("not a function: %s", function.Type())
     }
 }
 
-func extendFunctionEnv(fn *object.Function, args []object.Object) *object.Environment {
+// a default is evaluated after every argument is bound, a left out parameter is null until its default runs
+func extendFunctionEnv(fn *object.Function, args []object.Object) (*object.Environment, *object.Error) {
+    err := object.CheckArity(fn.Required(), len(fn.Parameters), fn.Rest != nil, len(args))
+    if err != nil {
+        return nil, newError("%s", err)
+    }
+
     env := object.NewEnclosedEnvironment(fn.Env)
+    env.SetFunctionName(fn.Name)
 
     for index, param := range fn.Parameters {
-        env.Set(param.Value, args[index])
+        if index < len(args) {
+            env.Set(param.Value, args[index])
+        } else {
+            env.Set(param.Value, NULL)
+        }
+    }
+
+    if fn.Rest != nil {
+        rest := []object.Object{}
+        if len(args) > len(fn.Parameters) {
+            rest = append(rest, args[len(fn.Parameters):]...)
+        }
+        env.Set(fn.Rest.Value, &object.Array{Elements: rest})
+    }
+
+    for index := len(args); index < len(fn.Parameters); index++ {
+        value := Eval(fn.Defaults[index], env)
+        if isError(value) {
+            return nil, value.(*object.Error)
+        }
+        env.Set(fn.Parameters[index].Value, value)
     }
 
-    return env
+    return env, nil
 }
 
 func unwrapReturnValue(obj object.Object) object.Object {
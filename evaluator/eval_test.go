@@ -1,9 +1,11 @@
 package evaluator
 
 import (
+    "monkey/internal/testutil"
     "monkey/lexer"
     "monkey/object"
     "monkey/parser"
+    "strings"
     "testing"
 )
 
@@ -36,6 +38,16 @@ func TestEvalIntegerExpression(t *testing.T) {
         {"3 * 3 * 3 + 10", 37},
         {"3 * (3 * 3) + 10", 37},
         {"(5 + 10 * 2 + 15 / 3) * 2 + -10", 50},
+        {"7 % 3", 1},
+        {"-7 % 3", -1},
+        {"6 & 3", 2},
+        {"6 | 3", 7},
+        {"6 ^ 3", 5},
+        {"1 << 4", 16},
+        {"-16 >> 2", -4},
+        {"~5", -6},
+        {"1 + 2 << 3", 17},
+        {"5 & 1 + 2", 3},
     }
 
     for _, tt := range tests {
@@ -83,6 +95,13 @@ func TestEvalBooleanExpression(t *testing.T) {
         {"(1 < 2) == false", false},
         {"(1 > 2) == true", false},
         {"(1 > 2) == false", true},
+        {"1 <= 1", true},
+        {"2 <= 1", false},
+        {"1 >= 1", true},
+        {"1 >= 2", false},
+        {"1.5 <= 2", true},
+        {"2 >= 2.5", false},
+        {"4 & 1 == 0", true},
     }
 
     for _, tt := range tests {
@@ -137,6 +156,11 @@ func TestIfElseExpression(t *testing.T) {
         {"if (1 > 2) { 10 }", nil},
         {"if (1 > 2) { 10 } else { 20 }", 20},
         {"if (1 < 2) { 10 } else { 20 }", 10},
+        {"if (1 > 2) { 10 } else if (2 > 1) { 20 } else { 30 }", 20},
+        {"if (1 > 2) { 10 } else if (2 > 3) { 20 } else if (3 > 2) { 30 }", 30},
+        {"if (1 > 2) { 10 } else if (2 > 3) { 20 } else { 30 }", 30},
+        {"if (1 > 2) { 10 } else if (2 > 3) { 20 }", nil},
+        {"if (1 < 2) { 10 } else if (2 > 1) { 20 } else { 30 }", 10},
     }
 
     for _, tt := range tests {
@@ -204,6 +228,11 @@ func TestErrorHandling(t *testing.T) {
         `, "unknown operator: BOOLEAN + BOOLEAN"},
         {"foobar", "identifier not found: foobar"},
         {`"Hello" - "World"`, "unknown operator: STRING - STRING"},
+        {"1 / 0", "division by zero"},
+        {"let f = fn(x) { 10 % x }; f(0)", "modulo by zero"},
+        {"1 << -1", "negative shift count: -1"},
+        {"1.5 & 1", "unknown operator: FLOAT & INTEGER"},
+        {"~1.5", "unknown operator: ~FLOAT"},
         // {`{"name": "Monkey"}[fn(x) { x }];`, "unusable as hash key: FUNCTION"},
     }
 
@@ -221,6 +250,166 @@ func TestErrorHandling(t *testing.T) {
     }
 }
 
+func TestErrorPositions(t *testing.T) {
+    tests := []struct {
+        input string
+        expected string
+    }{
+        {"5 + true;", "ERROR: 1:3: type mismatch: INTEGER + BOOLEAN"},
+        {"let a = 1;\n  foobar", "ERROR: 2:3: identifier not found: foobar"},
+        {"let f = fn() {\n  -true\n};\nf()", "ERROR: 2:3: unknown operator: -BOOLEAN"},
+        {"len(1)", "ERROR: 1:4: argument to `len` not supported, got INTEGER"},
+    }
+
+    for _, tt := range tests {
+        evaluated := testEval(tt.input)
+        errObj, ok := evaluated.(*object.Error)
+        if !ok {
+            t.Errorf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+            continue
+        }
+
+        if errObj.Inspect() != tt.expected {
+            t.Errorf("wrong error. expected=%q, got=%q", tt.expected, errObj.Inspect())
+        }
+    }
+}
+
+func TestWhileStatements(t *testing.T) {
+    tests := []struct {
+        input string
+        expected int64
+    }{
+        {"let f = fn(n) { while (n > 0) { return n; } }; f(3)", 3},
+        {`
+            let count = [];
+            while (true) {
+                append(count, 1);
+                if (len(count) == 5) { break; }
+            }
+            len(count)
+        `, 5},
+        {`
+            let seen = [];
+            let odd = [];
+            while (len(seen) < 6) {
+                append(seen, 1);
+                if (len(seen) / 2 * 2 == len(seen)) { continue; }
+                append(odd, len(seen));
+            }
+            len(odd)
+        `, 3},
+        {`
+            let outer = [];
+            let pairs = [];
+            while (len(outer) < 3) {
+                append(outer, 1);
+                let inner = [];
+                while (true) {
+                    append(inner, 1);
+                    if (len(inner) == 2) { break; }
+                    append(pairs, 1);
+                }
+            }
+            len(pairs)
+        `, 3},
+    }
+
+    for _, tt := range tests {
+        testIntegerObject(t, testEval(tt.input), tt.expected)
+    }
+}
+
+func TestForStatements(t *testing.T) {
+    tests := []struct {
+        input string
+        expected interface{}
+    }{
+        {"let out = []; for (x in [1, 2, 3]) { append(out, x * 2); } out", "[2, 4, 6]"},
+        {"let out = []; for (i, x in [7, 8]) { append(out, i); append(out, x); } out", "[0, 7, 1, 8]"},
+        {`let out = []; for (c in "abc") { append(out, c); } out`, "[a, b, c]"},
+        {`let out = []; for (i, c in "ab") { append(out, i); } out`, "[0, 1]"},
+        {`let out = []; for (k in {"b": 2, "c": 3, "a": 1}) { append(out, k); } out`, "[a, b, c]"},
+        {`let out = []; for (k, v in {3: "c", 1: "a", 2: "b"}) { append(out, k); append(out, v); } out`, "[1, a, 2, b, 3, c]"},
+        {"let out = []; for (x in [1, 2, 3, 4]) { if (x == 3) { break; } append(out, x); } out", "[1, 2]"},
+        {"let out = []; for (x in [1, 2, 3, 4]) { if (x == 2) { continue; } append(out, x); } out", "[1, 3, 4]"},
+        {"let f = fn(xs) { for (x in xs) { if (x > 1) { return x; } } }; f([1, 5, 6])", "5"},
+        {"let out = []; for (x in []) { append(out, x); } out", "[]"},
+        {"for (x in 5) { x }", "ERROR: 1:1: cannot iterate over INTEGER"},
+    }
+
+    for _, tt := range tests {
+        evaluated := testEval(tt.input)
+        if evaluated.Inspect() != tt.expected {
+            t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+        }
+    }
+}
+
+func TestDestructuringLet(t *testing.T) {
+    tests := []struct {
+        input string
+        expected string
+    }{
+        {"let [a, b] = [1, 2]; a + b", "3"},
+        {"let [first, ...rest] = [1, 2, 3]; rest", "[2, 3]"},
+        {"let [a, b, ...rest] = [1, 2]; rest", "[]"},
+        {"let [...all] = [1, 2]; all", "[1, 2]"},
+        {"let a = 1; let b = 2; let [a, b] = [b, a]; [a, b]", "[2, 1]"},
+        {"let xs = [1, 2, 3]; let [x, ...rest] = xs; rest[0] = 9; xs", "[1, 2, 3]"},
+        {"let f = fn() { [1, 2] }; let [x, y] = f(); x * 10 + y", "12"},
+        {`let {name, age} = {"name": "mamad", "age": 30, "x": 1}; name + str(age)`, "mamad30"},
+        {`let f = fn(p) { let {x, y} = p; x + y }; f({"x": 1, "y": 2})`, "3"},
+        {"let [a, b] = [1, 2, 3]", "ERROR: 1:1: wrong number of elements to destructure: want 2, got 3"},
+        {"let [a, b, ...c] = [1]", "ERROR: 1:1: not enough elements to destructure: want at least 2, got 1"},
+        {"let [a] = 5", "ERROR: 1:1: cannot destructure INTEGER as an array"},
+        {`let {a} = [1]`, "ERROR: 1:1: cannot destructure ARRAY as a hash map"},
+        {`let {a, b} = {"a": 1}`, `ERROR: 1:1: key "b" not found in hash map`},
+    }
+
+    for _, tt := range tests {
+        evaluated := testEval(tt.input)
+        if evaluated.Inspect() != tt.expected {
+            t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+        }
+    }
+}
+
+func TestAssignExpressions(t *testing.T) {
+    tests := []struct {
+        input string
+        expected string
+    }{
+        {"let a = 1; a = 2; a", "2"},
+        {"let a = 1; let b = a = 3; a + b", "6"},
+        {"let i = 0; while (i < 10) { i = i + 1; } i", "10"},
+        {"let n = 0; let inc = fn() { n = n + 1 }; inc(); inc(); n", "2"},
+        {"let f = fn() { let x = 1; let g = fn() { x = x + 1 }; g(); x }; f()", "2"},
+        {"let f = fn(x) { x = x * 2; x }; f(4)", "8"},
+        {"let a = [1, 2, 3]; a[1] = 5; a", "[1, 5, 3]"},
+        {"let a = [1, 2, 3]; a[0] = a[2] = 0; a", "[0, 2, 0]"},
+        {`let h = {"a": 1}; h["a"] = 2; h["b"] = 3; h["a"] + h["b"]`, "5"},
+        {"x = 1", "ERROR: 1:1: cannot assign to undefined variable x"},
+        {"len = 1", "ERROR: 1:1: cannot assign to builtin len"},
+        {"let f = fn() { f = 1 }; f()", "ERROR: 1:16: cannot assign to function name f"},
+        {"let f = fn() { fn() { f = 1 } }; f()()", "ERROR: 1:23: cannot assign to function name f"},
+        {"let f = fn(f) { f = 1; f }; f(0)", "1"},
+        {"let f = fn() { let f = 2; f = 3; f }; f()", "3"},
+        {"let len = 1; len = 2; len", "2"},
+        {"let a = [1]; a[1] = 2", "ERROR: 1:15: index out of range: 1"},
+        {`let a = [1]; a["x"] = 2`, "ERROR: 1:15: array index must be INTEGER, got STRING"},
+        {"let h = {}; h[fn(x) { x }] = 1", "ERROR: 1:14: unusable as hash key: FUNCTION"},
+        {"let s = 1; s[0] = 2", "ERROR: 1:13: index assignment not supported: INTEGER"},
+    }
+
+    for _, tt := range tests {
+        evaluated := testEval(tt.input)
+        if evaluated.Inspect() != tt.expected {
+            t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+        }
+    }
+}
+
 func TestLetStatements(t *testing.T) {
     tests := []struct {
         input string
@@ -261,6 +450,168 @@ func TestFunctionObject(t *testing.T) {
     }
 }
 
+func TestDefaultAndRestParameters(t *testing.T) {
+    tests := []struct {
+        input string
+        expected string
+    }{
+        {"let f = fn(a, b = 10) { a + b }; f(1)", "11"},
+        {"let f = fn(a, b = 10) { a + b }; f(1, 2)", "3"},
+        {"let f = fn(a, b = a * 2) { b }; f(4)", "8"},
+        {"let f = fn(a = b, b = 2) { a }; f()", "null"},
+        {"let n = 0; let f = fn(x = n) { x }; n = 7; f()", "7"},
+        {"let calls = 0; let f = fn(x = calls = calls + 1) { x }; f(); f(); f(9); calls", "2"},
+        {"let f = fn(a = []) { append(a, 1); a }; f(); f()", "[1]"},
+        {"let f = fn(...rest) { rest }; f(1, 2, 3)", "[1, 2, 3]"},
+        {"let f = fn(...rest) { rest }; f()", "[]"},
+        {"let f = fn(a, b = 2, ...rest) { [a, b, rest] }; f(1)", "[1, 2, []]"},
+        {"let f = fn(a, b = 2, ...rest) { [a, b, rest] }; f(1, 3, 5, 7)", "[1, 3, [5, 7]]"},
+        {"let f = fn(a, b) { a }; f(1)", "ERROR: 1:26: wrong number of arguments: want=2, got=1"},
+        {"let f = fn(a, b = 1) { a }; f()", "ERROR: 1:30: wrong number of arguments: want=1 to 2, got=0"},
+        {"let f = fn(a, b = 1) { a }; f(1, 2, 3)", "ERROR: 1:30: wrong number of arguments: want=1 to 2, got=3"},
+        {"let f = fn(a, ...r) { a }; f()", "ERROR: 1:29: wrong number of arguments: want=at least 1, got=0"},
+        {"let f = fn(a = x) { a }; f()", "ERROR: 1:16: identifier not found: x"},
+    }
+
+    for _, tt := range tests {
+        evaluated := testEval(tt.input)
+        if evaluated.Inspect() != tt.expected {
+            t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+        }
+    }
+}
+
+func TestTryCatch(t *testing.T) {
+    tests := []struct {
+        input string
+        expected string
+    }{
+        {"let r = 0; try { r = 1 / 0; } catch (e) { r = e.message; } r", "division by zero"},
+        {"let r = 0; try {\n  r = 1 / 0;\n} catch (e) { r = [e.line, e.column]; } r", "[2, 9]"},
+        {`let r = 0; try { throw "boom"; } catch (e) { r = e; } r`, "boom"},
+        {"let r = 0; try { throw [1, 2]; } catch (e) { r = e; } r", "[1, 2]"},
+        {"let r = 0; try { r = 1; } catch (e) { r = 2; } r", "1"},
+        {"let r = []; try { r = append(r, 1); } finally { r = append(r, 2); } r", "[1, 2]"},
+        {"let r = []; try { throw 1; } catch (e) { r = append(r, e); } finally { r = append(r, 2); } r", "[1, 2]"},
+        {"let r = []; let f = fn() { try { return 1; } finally { r = append(r, 2); } }; [f(), r]", "[1, [2]]"},
+        {"let r = []; let f = fn() { try { return 1; } finally { return 2; } }; f()", "2"},
+        {"let r = []; for (x in [1, 2, 3]) { try { if (x == 2) { continue; } if (x == 3) { break; } } finally { r = append(r, x); } } r", "[1, 2, 3]"},
+        {"let r = []; try { try { throw 1; } finally { r = append(r, 2); } } catch (e) { r = append(r, e); } r", "[2, 1]"},
+        {"let r = []; try { try { throw 1; } catch (e) { throw e + 1; } finally { r = append(r, 3); } } catch (e) { r = append(r, e); } r", "[3, 2]"},
+        {"let f = fn(x) { 1 / x }; let g = fn() { f(0) }; let r = 0; try { g(); } catch (e) { r = e.message; } r", "division by zero"},
+        {`let r = 0; try { throw {"message": "custom", "code": 7}; } catch (e) { r = e.code; } r`, "7"},
+        {"let f = fn(x) { if (x > 0) { throw x; } 0 }; let r = 0; for (x in [0, 3]) { try { r = r + f(x); } catch (e) { r = r + e * 10; } } r", "30"},
+        {`throw "boom"`, "ERROR: 1:1: uncaught exception: boom"},
+        {"let f = fn() {\n  throw 7;\n}; f()", "ERROR: 2:3: uncaught exception: 7"},
+        {`try { throw "boom"; } finally { 1; }`, "ERROR: 1:7: uncaught exception: boom"},
+        {"try { 1 / 0; } finally { 1; }", "ERROR: 1:9: division by zero"},
+    }
+
+    for _, tt := range tests {
+        evaluated := testEval(tt.input)
+        if evaluated.Inspect() != tt.expected {
+            t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+        }
+    }
+}
+
+func TestMatchExpressions(t *testing.T) {
+    describe := `let describe = fn(x) {
+        match (x) {
+            0 => "zero",
+            -1 => "minus one",
+            2.5 => "two and a half",
+            "hi" => "greeting",
+            true => "yes",
+            [] => "empty",
+            [a] => "one: " + str(a),
+            [a, b] => "pair: " + str(a + b),
+            [a, ...rest] if (len(rest) > 2) => "long",
+            [[a, b], ...rest] => "nested: " + str(a * b),
+            {"type": "point", x, y} => "point: " + str(x + y),
+            {"type": t} => "typed: " + t,
+            {} => "hash",
+            n if (n > 100) => "big",
+            _ => "other",
+        }
+    };`
+
+    tests := []struct {
+        input string
+        expected string
+    }{
+        {describe + "describe(0)", "zero"},
+        {describe + "describe(0.0)", "zero"},
+        {describe + "describe(-1)", "minus one"},
+        {describe + "describe(2.5)", "two and a half"},
+        {describe + `describe("hi")`, "greeting"},
+        {describe + "describe(true)", "yes"},
+        {describe + "describe([])", "empty"},
+        {describe + "describe([7])", "one: 7"},
+        {describe + "describe([3, 4])", "pair: 7"},
+        {describe + "describe([1, 2, 3, 4])", "long"},
+        {describe + "describe([[2, 3], 4, 5])", "nested: 6"},
+        {describe + `describe({"type": "point", "x": 1, "y": 2})`, "point: 3"},
+        {describe + `describe({"type": "point", "x": 1})`, "typed: point"},
+        {describe + `describe({"type": "circle", "r": 1})`, "typed: circle"},
+        {describe + `describe({"r": 1})`, "hash"},
+        {describe + "describe(101)", "big"},
+        {describe + "describe(100)", "other"},
+        {`match ([1, 2, 3]) { [a, b] => "pair", [[a], ...r] => "nested", ["x", ...r] => "x", _ => "other" }`, "other"},
+        {`match (false) { true => "yes", 0 => "zero", "" => "empty", _ => "other" }`, "other"},
+        {"match ([1, 2, 3]) { [first, ...rest] => rest }", "[2, 3]"},
+        {"match ([1, 2, 3]) { [first, ..._] => first }", "1"},
+        {"match (5) { x => x * 2 }", "10"},
+        {"let x = 1; match (5) { x if (x < 3) => 0, _ => x }", "1"},
+        {`match ({1: "a", true: "b"}) { {1: a, true: b} => a + b }`, "ab"},
+        {`match ("5") { 5 => "int", "5" => "string" }`, "string"},
+        {"let f = fn(n) { match (n) { 0 => 1, _ => n * f(n - 1) } }; f(5)", "120"},
+        {"match (5) { 1 => 2 }", "ERROR: 1:1: no match arm for 5"},
+        {`match ([1, 2]) { [a] => a, {"a": a} => a }`, "ERROR: 1:1: no match arm for [1, 2]"},
+        {"match (5) { x if (x + true) => 1 }", "ERROR: 1:21: type mismatch: INTEGER + BOOLEAN"},
+        {"match ([1, 2]) { [a, 3] => 0, _ => a }", "ERROR: 1:36: identifier not found: a"},
+        {"match (1) { a => a }; a", "ERROR: 1:23: identifier not found: a"},
+    }
+
+    for _, tt := range tests {
+        evaluated := testEval(tt.input)
+        if evaluated.Inspect() != tt.expected {
+            t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+        }
+    }
+}
+
+func TestImports(t *testing.T) {
+    dir := testutil.WriteFiles(t, testutil.Modules)
+
+    tests := []struct {
+        input string
+        expected string
+    }{
+        {`let m = import "DIR/lib/math.monkey"; m.square(4) + m.quad(1)`, "20"},
+        {`let m = import "DIR/lib/math.monkey"; m.one + m["two"]`, "3"},
+        {`(import "DIR/lib/uses.monkey").nine`, "9"},
+        {`let a = import "DIR/lib/math.monkey"; let b = import "DIR/lib/uses.monkey"; a.state.count = 5; (import "DIR/lib/math.monkey").state.count`, "5"},
+        {`let f = fn() { import "DIR/lib/math.monkey" }; f().two`, "2"},
+        {`import "DIR/lib/math.monkey"`, "module(DIR/lib/math.monkey)"},
+        {"let m = import \"DIR/lib/math.monkey\";\nm.secret", `ERROR: 2:2: module DIR/lib/math.monkey has no export "secret"`},
+        {"let m = import \"DIR/lib/math.monkey\";\nm.one = 2", "ERROR: 2:2: index assignment not supported: MODULE"},
+        {`import "DIR/cycle_a.monkey"`, "ERROR: DIR/cycle_b.monkey:1:1: import cycle: DIR/cycle_a.monkey -> DIR/cycle_b.monkey -> DIR/cycle_a.monkey"},
+        {`import "DIR/missing.monkey"`, "ERROR: 1:1: cannot import DIR/missing.monkey: no such file or directory"},
+        {`import "DIR/broken.monkey"`, "ERROR: 1:1: cannot import DIR/broken.monkey: DIR/broken.monkey:1:5: expected next token to be {IDENT}, got {=} instead"},
+    }
+
+    for _, tt := range tests {
+        input := strings.ReplaceAll(tt.input, "DIR", dir)
+        expected := strings.ReplaceAll(tt.expected, "DIR", dir)
+
+        evaluated := testEval(input)
+        if evaluated.Inspect() != expected {
+            t.Errorf("wrong result for %q. expected=%q, got=%q", input, expected, evaluated.Inspect())
+        }
+    }
+}
+
 func TestFunctionApplication(t *testing.T) {
     tests := []struct {
         input string
@@ -292,6 +643,29 @@ func TestClosures(t *testing.T) {
     testIntegerObject(t, testEval(input), 4)
 }
 
+// the vm keeps captured variables in cells, these have to come out the same on both engines
+func TestMutableCaptures(t *testing.T) {
+    tests := []struct {
+        input string
+        expected int64
+    }{
+        {"let make = fn() { let c = 0; fn() { c = c + 1; c } }; let f = make(); f(); f()", 2},
+        {"let make = fn() { let c = 0; [fn() { c = c + 1 }, fn() { c }] }; let p = make(); p[0](); p[0](); p[1]()", 2},
+        {"let f = fn() { let x = 1; let g = fn() { x = 5 }; g(); x }; f()", 5},
+        {"let f = fn() { let x = 1; let g = fn() { x }; x = 7; g() }; f()", 7},
+        {"let f = fn(a) { fn() { fn() { a = a + 1; a } } }; let g = f(1)(); g(); g()", 3},
+        {"let make = fn() { let c = 0; fn() { c = c + 1; c } }; let a = make(); let b = make(); a(); a(); b()", 1},
+        {"let make = fn(n) { let c = n; fn() { c } }; let a = make(1); let b = make(2); a() + b()", 3},
+        {"let f = fn() { let fs = []; for (i in [1, 2, 3]) { fs = append(fs, fn() { i }) } fs[0]() }; f()", 3},
+        {"let f = fn() { let fs = []; for (i in [1, 2, 3]) { fs = append(fs, match (i) { n => fn() { n } }) } fs[0]() + fs[2]() }; f()", 4},
+        {"let f = fn(n, acc) { let g = fn() { acc }; if (n == 0) { g() } else { f(n - 1, acc + 1) } }; f(3, 0)", 3},
+    }
+
+    for _, tt := range tests {
+        testIntegerObject(t, testEval(tt.input), tt.expected)
+    }
+}
+
 func TestStringLiteral(t *testing.T) {
     input := `"how ya doing mate";`
 
@@ -366,6 +740,140 @@ func TestBuiltinFunctions(t *testing.T) {
     }
 }
 
+func TestInterpolatedStrings(t *testing.T) {
+    tests := []struct {
+        input string
+        expected string
+    }{
+        {`let n = 4; "count: ${n + 1}"`, "count: 5"},
+        {`"${1.5} ${true} ${[1, "a"]} ${"str"}"`, `1.5 true [1, a] str`},
+        {`let name = "monkey"; "hi ${name}, ${"nested ${name}"}"`, "hi monkey, nested monkey"},
+        {`"${if (false) { 1 }}"`, "null"},
+        {`"\${x}"`, "${x}"},
+        {`"a ${missing} b"`, "ERROR: 1:6: identifier not found: missing"},
+    }
+
+    for _, tt := range tests {
+        evaluated := testEval(tt.input)
+        if str, ok := evaluated.(*object.String); ok {
+            if str.Value != tt.expected {
+                t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, tt.expected, str.Value)
+            }
+            continue
+        }
+
+        if evaluated.Inspect() != tt.expected {
+            t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+        }
+    }
+}
+
+func TestUnicodeStrings(t *testing.T) {
+    tests := []struct {
+        input string
+        expected string
+    }{
+        {`len("héllo")`, "5"},
+        {`len("سلام دنیا")`, "9"},
+        {`"héllo"[1]`, "é"},
+        {`"😀!"[0] + "😀!"[1]`, "😀!"},
+        {`"héllo"[5]`, "null"},
+        {`"héllo"[-1]`, "null"},
+        {`let out = []; for (c in "aé😀") { append(out, c); } out`, "[a, é, 😀]"},
+        {`let نام = "علی"; "سلام ${نام}"`, "سلام علی"},
+    }
+
+    for _, tt := range tests {
+        evaluated := testEval(tt.input)
+        if evaluated.Inspect() != tt.expected {
+            t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+        }
+    }
+}
+
+func TestLogicalExpressions(t *testing.T) {
+    tests := []struct {
+        input string
+        expected string
+    }{
+        {"true && true", "true"},
+        {"true && false", "false"},
+        {"false || true", "true"},
+        {"false || false", "false"},
+        {"1 && 2", "2"},
+        {"0 || 5", "0"},
+        {"false && 5", "false"},
+        {"if (false) { 1 } || 7", "7"},
+        {"1 < 2 && 2 < 3", "true"},
+        {"false && undefined", "false"},
+        {"true || undefined", "true"},
+        {"let hits = []; let f = fn() { append(hits, 1); true }; false && f(); true || f(); len(hits)", "0"},
+        {"true && undefined", "ERROR: 1:9: identifier not found: undefined"},
+    }
+
+    for _, tt := range tests {
+        evaluated := testEval(tt.input)
+        if evaluated.Inspect() != tt.expected {
+            t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+        }
+    }
+}
+
+func TestFloatExpressions(t *testing.T) {
+    tests := []struct {
+        input string
+        expected string
+    }{
+        {"3.5", "3.5"},
+        {"-2.5", "-2.5"},
+        {"1.5 + 1.5", "3.0"},
+        {"1 + 0.5", "1.5"},
+        {"7 / 2.0", "3.5"},
+        {"7 / 2", "3"},
+        {"1e3 * 2", "2000.0"},
+        {"0.1 - 1", "-0.9"},
+        {"1 == 1.0", "true"},
+        {"1.5 != 1.5", "false"},
+        {"2 < 2.5", "true"},
+        {"2.5 > 3", "false"},
+        {`{1: "a"}[1.0]`, "a"},
+        {`{2.5: "b"}[2.5]`, "b"},
+        {"1.5 + true", "ERROR: 1:5: type mismatch: FLOAT + BOOLEAN"},
+    }
+
+    for _, tt := range tests {
+        evaluated := testEval(tt.input)
+        if evaluated.Inspect() != tt.expected {
+            t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+        }
+    }
+}
+
+func TestConversionBuiltins(t *testing.T) {
+    tests := []struct {
+        input string
+        expected string
+    }{
+        {"int(3.9)", "3"},
+        {"int(-3.9)", "-3"},
+        {`int("42")`, "42"},
+        {"int(7)", "7"},
+        {"float(2)", "2.0"},
+        {`float("1.25")`, "1.25"},
+        {`str(1.5) + str(2) + str([1])`, "1.52[1]"},
+        {`int("x")`, `ERROR: 1:4: could not parse "x" as integer`},
+        {`float(true)`, "ERROR: 1:6: argument to `float` not supported, got BOOLEAN"},
+        {`int(1e300 * 1e300)`, "ERROR: 1:4: cannot convert +Inf to INTEGER"},
+    }
+
+    for _, tt := range tests {
+        evaluated := testEval(tt.input)
+        if evaluated.Inspect() != tt.expected {
+            t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+        }
+    }
+}
+
 func TestArrayLiterals(t *testing.T) {
     input := "[1, 2 * 2, 3 + 3]"
 
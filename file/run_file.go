@@ -2,28 +2,84 @@ package file
 
 import (
 	"fmt"
+	"io"
+	"monkey/compiler"
 	"monkey/evaluator"
 	"monkey/lexer"
 	"monkey/object"
 	"monkey/parser"
     "monkey/repl"
+    "monkey/vm"
 	"os"
 )
 
-func Run_file(file_name string) {
+const (
+    EngineVM = "vm"
+    EngineEval = "eval"
+)
+
+// exit codes of Run_file, so scripts can be told apart by how they failed
+const (
+    ExitOK = 0
+    ExitRuntimeError = 1
+    ExitUsage = 2
+    ExitIOError = 3
+    ExitSyntaxError = 4
+    ExitCompileError = 5
+)
+
+// Run_file runs a script with the given engine and returns the exit code.
+// every diagnostic is written to errOut.
+func Run_file(file_name string, engine string, errOut io.Writer) int {
+    return Run_file_With_Options(file_name, engine, vm.Options{}, errOut)
+}
+
+// Run_file_With_Options is Run_file with the limits of the vm, the evaluator ignores them
+func Run_file_With_Options(file_name string, engine string, opts vm.Options, errOut io.Writer) int {
+    if engine != EngineVM && engine != EngineEval {
+        fmt.Fprintf(errOut, "unknown engine: %s\n", engine)
+        return ExitUsage
+    }
+
     program_text, err := os.ReadFile(file_name)
     if err != nil {
-        fmt.Printf("Error: %s\n", err)
+        fmt.Fprintf(errOut, "Error: %s\n", err)
+        return ExitIOError
     }
 
-    evn := object.NewEnvironment()
-    lex := lexer.NewLexer(string(program_text))
+    lex := lexer.NewLexerWithFile(string(program_text), file_name)
     parser := parser.NewParser(lex)
     program := parser.ParseProgram()
 
     if len(parser.Errors()) != 0 {
-        repl.PrintParserErrors(os.Stdout, parser.Errors())
+        repl.PrintParserErrors(errOut, parser.Errors())
+        return ExitSyntaxError
+    }
+
+    if engine == EngineEval {
+        env := object.NewEnvironment()
+        result := evaluator.Eval(program, env)
+        if errObj, ok := result.(*object.Error); ok {
+            fmt.Fprintln(errOut, errObj.Inspect())
+            return ExitRuntimeError
+        }
+
+        return ExitOK
+    }
+
+    comp := compiler.New_Compiler()
+    err = comp.Compile(program)
+    if err != nil {
+        fmt.Fprintf(errOut, "Compilation failed:\n %s\n", err)
+        return ExitCompileError
+    }
+
+    virt_machine := vm.New_VM_With_Options(comp.Bytecode(), opts)
+    err = virt_machine.Run()
+    if err != nil {
+        repl.PrintRuntimeError(errOut, err)
+        return ExitRuntimeError
     }
 
-    _ = evaluator.Eval(program, evn)
+    return ExitOK
 }
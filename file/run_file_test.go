@@ -0,0 +1,135 @@
+package file
+
+import (
+    "bytes"
+    "monkey/internal/testutil"
+    "monkey/vm"
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+)
+
+func TestRunFileExitCodes(t *testing.T) {
+    tests := []struct {
+        source string
+        expectedCode int
+        expectedErr string
+    }{
+        {"let a = 1; a + 1;", ExitOK, ""},
+        {"let a = ;", ExitSyntaxError, "no prefix parse function for {;} found"},
+        {"let f = fn() { a }; f();", ExitCompileError, "undefined variable a"},
+        {"let f = fn() { 1 + true }; f();", ExitRuntimeError, "INTEGER"},
+        {"len(1); 5", ExitRuntimeError, "argument to `len` not supported, got INTEGER"},
+        {"let a = 1;\nreturn a;\n1 + true;", ExitOK, ""},
+    }
+
+    dir := t.TempDir()
+
+    for i, tt := range tests {
+        path := filepath.Join(dir, "test.monkey")
+        err := os.WriteFile(path, []byte(tt.source), 0644)
+        if err != nil {
+            t.Fatalf("could not write test file: %s", err)
+        }
+
+        for _, engine := range []string{EngineVM, EngineEval} {
+            expectedCode := tt.expectedCode
+            if engine == EngineEval && expectedCode == ExitCompileError {
+                expectedCode = ExitRuntimeError // the evaluator only notices at run time
+            }
+
+            var errOut bytes.Buffer
+            code := Run_file(path, engine, &errOut)
+
+            if code != expectedCode {
+                t.Errorf("tests[%d] (%s) - wrong exit code. want=%d, got=%d (%s)", i, engine, expectedCode, code, errOut.String())
+            }
+
+            if tt.expectedErr == "" && errOut.Len() != 0 {
+                t.Errorf("tests[%d] (%s) - unexpected error output: %q", i, engine, errOut.String())
+            }
+
+            if tt.expectedErr != "" && engine == EngineVM && !strings.Contains(errOut.String(), tt.expectedErr) {
+                t.Errorf("tests[%d] (%s) - error output %q does not contain %q", i, engine, errOut.String(), tt.expectedErr)
+            }
+        }
+    }
+}
+
+func TestRunFileMissingFile(t *testing.T) {
+    var errOut bytes.Buffer
+    code := Run_file(filepath.Join(t.TempDir(), "missing.monkey"), EngineVM, &errOut)
+
+    if code != ExitIOError {
+        t.Errorf("wrong exit code. want=%d, got=%d", ExitIOError, code)
+    }
+
+    if errOut.Len() == 0 {
+        t.Errorf("expected an error message for a missing file")
+    }
+}
+
+func TestRunFileWithOptions(t *testing.T) {
+    dir := testutil.WriteFiles(t, map[string]string{
+        "deep.monkey": "let f = fn(n) { if (n == 0) { 0 } else { 1 + f(n - 1) } }; f(5000);",
+    })
+    path := filepath.Join(dir, "deep.monkey")
+
+    var errOut bytes.Buffer
+    code := Run_file(path, EngineVM, &errOut)
+    if code != ExitRuntimeError || !strings.Contains(errOut.String(), "stack overflow at depth") {
+        t.Errorf("expected a stack overflow with the default limits, got code=%d (%s)", code, errOut.String())
+    }
+
+    errOut.Reset()
+    code = Run_file_With_Options(path, EngineVM, vm.Options{MaxStackSize: 100000, MaxFrames: 10000}, &errOut)
+    if code != ExitOK {
+        t.Errorf("wrong exit code with raised limits. want=%d, got=%d (%s)", ExitOK, code, errOut.String())
+    }
+}
+
+func TestRunFileImports(t *testing.T) {
+    files := map[string]string{
+        "main.monkey": `let m = import "lib/math.monkey"; if (m.square(3) != 9) { 1 + true }`,
+        "lib/math.monkey": `let h = import "helpers.monkey"; export let square = fn(x) { h.mul(x, x) };`,
+        "lib/helpers.monkey": `export let mul = fn(a, b) { a * b };`,
+        "cycle.monkey": `import "back.monkey";`,
+        "back.monkey": `import "cycle.monkey";`,
+        "fails.monkey": `import "lib/bad.monkey";`,
+        "lib/bad.monkey": `export let x = 1 + true;`,
+    }
+
+    dir := testutil.WriteFiles(t, files)
+
+    tests := []struct {
+        file string
+        expectedCode int
+        expectedErr string
+    }{
+        {"main.monkey", ExitOK, ""},
+        {"cycle.monkey", ExitCompileError, "import cycle: DIR/cycle.monkey -> DIR/back.monkey -> DIR/cycle.monkey"},
+        {"fails.monkey", ExitRuntimeError, "DIR/lib/bad.monkey:1:18: "},
+    }
+
+    for i, tt := range tests {
+        for _, engine := range []string{EngineVM, EngineEval} {
+            expectedCode := tt.expectedCode
+            if engine == EngineEval && expectedCode == ExitCompileError {
+                expectedCode = ExitRuntimeError
+            }
+
+            var errOut bytes.Buffer
+            code := Run_file(filepath.Join(dir, tt.file), engine, &errOut)
+
+            if code != expectedCode {
+                t.Errorf("tests[%d] (%s) - wrong exit code. want=%d, got=%d (%s)", i, engine, expectedCode, code, errOut.String())
+            }
+
+            expectedErr := strings.ReplaceAll(tt.expectedErr, "DIR", dir)
+            if !strings.Contains(errOut.String(), expectedErr) {
+                t.Errorf("tests[%d] (%s) - error output %q does not contain %q", i, engine, errOut.String(), expectedErr)
+            }
+        }
+    }
+}
@@ -0,0 +1,41 @@
+// helpers shared by the tests of the evaluator, the vm and the file runner
+package testutil
+
+import (
+    "os"
+    "path/filepath"
+    "testing"
+)
+
+// the modules the evaluator and vm import tests use, by their path in the directory
+var Modules = map[string]string{
+    "lib/math.monkey": `
+        let twice = fn(x) { x * 2 };
+        export let square = fn(x) { x * x };
+        export let quad = fn(x) { twice(twice(x)) };
+        export let [one, two] = [1, 2];
+        export let state = {"count": 0};
+        let secret = 42;`,
+    "lib/uses.monkey": `let m = import "math.monkey"; export let nine = m.square(3);`,
+    "cycle_a.monkey": `import "cycle_b.monkey";`,
+    "cycle_b.monkey": `import "cycle_a.monkey";`,
+    "broken.monkey": `let = 1;`,
+}
+
+// WriteFiles writes the files, keyed by their slash separated path, into a temporary directory and returns it
+func WriteFiles(t *testing.T, files map[string]string) string {
+    t.Helper()
+
+    dir := t.TempDir()
+    for name, source := range files {
+        path := filepath.Join(dir, filepath.FromSlash(name))
+        if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+            t.Fatalf("could not create directory: %s", err)
+        }
+        if err := os.WriteFile(path, []byte(source), 0644); err != nil {
+            t.Fatalf("could not write file: %s", err)
+        }
+    }
+
+    return dir
+}
@@ -1,30 +1,56 @@
 package lexer
 
 import (
+	"fmt"
 	"monkey/token"
+	"strings"
+	"unicode"
+	"unicode/utf8"
 )
 
 type Lexer struct {
 	input        string
 	position     int
 	readPosition int
-	ch           byte
+	ch           rune // position and readPosition are byte offsets into input
+
+	file   string
+	line   int // line and column of ch
+	column int
+
+	interp []int // one entry per open ${ in a string, counting the { } opened inside of it
 }
 
 func NewLexer(input string) *Lexer {
-	lex := &Lexer{input: input}
+	return NewLexerWithFile(input, "")
+}
+
+// the file name only shows up in the positions of the tokens
+func NewLexerWithFile(input string, file string) *Lexer {
+	lex := &Lexer{input: input, file: file, line: 1}
 	lex.readChar()
 	return lex
 }
 
 func (l *Lexer) readChar() {
+	if l.ch == '\n' {
+		l.line++
+		l.column = 0
+	}
+
+	width := 1
 	if l.readPosition >= len(l.input) {
 		l.ch = 0
 	} else {
-		l.ch = l.input[l.readPosition]
+		l.ch, width = utf8.DecodeRuneInString(l.input[l.readPosition:])
 	}
 	l.position = l.readPosition
-	l.readPosition += 1
+	l.readPosition += width
+	l.column += 1 // columns count characters, not bytes
+}
+
+func (l *Lexer) currentPosition() token.Position {
+	return token.Position{File: l.file, Line: l.line, Column: l.column}
 }
 
 func (l *Lexer) NextToken() token.Token {
@@ -32,12 +58,31 @@ func (l *Lexer) NextToken() token.Token {
 
 	l.skipWhitespace()
 
+	// comments don't become tokens of their own, they're kept on the token that follows them
+	var comments []token.Comment
+	for l.ch == '/' && (l.peekChar() == '/' || l.peekChar() == '*') {
+		comment, ok := l.readComment()
+		if !ok {
+			tok = token.Token{Type: token.ILLEGAL, Literal: "unterminated block comment", Pos: comment.Pos}
+			tok.Comments = comments
+			return tok
+		}
+
+		comments = append(comments, comment)
+		l.skipWhitespace()
+	}
+
+	pos := l.currentPosition()
+
 	switch l.ch {
 	case '=':
         if l.peekChar() == '=' {
             ch := l.ch
             l.readChar()
             tok = token.Token{Type: token.EQ, Literal: string(ch) + string(l.ch)}
+        } else if l.peekChar() == '>' {
+            l.readChar()
+            tok = token.Token{Type: token.ARROW, Literal: "=>"}
         } else {
             tok = token.NewToken(token.ASSIGN, l.ch)
         }
@@ -57,12 +102,58 @@ func (l *Lexer) NextToken() token.Token {
         tok = token.NewToken(token.SLASH, l.ch)
     case '*':
         tok = token.NewToken(token.ASTERISK, l.ch)
+    case '%':
+        tok = token.NewToken(token.PERCENT, l.ch)
+    case '^':
+        tok = token.NewToken(token.CARET, l.ch)
+    case '~':
+        tok = token.NewToken(token.TILDE, l.ch)
+    case '&':
+        if l.peekChar() == '&' {
+            l.readChar()
+            tok = token.Token{Type: token.AND, Literal: "&&"}
+        } else {
+            tok = token.NewToken(token.AMPERSAND, l.ch)
+        }
+    case '|':
+        if l.peekChar() == '|' {
+            l.readChar()
+            tok = token.Token{Type: token.OR, Literal: "||"}
+        } else {
+            tok = token.NewToken(token.PIPE, l.ch)
+        }
     case '<':
-        tok = token.NewToken(token.LT, l.ch)
+        switch l.peekChar() {
+        case '=':
+            l.readChar()
+            tok = token.Token{Type: token.LT_EQ, Literal: "<="}
+        case '<':
+            l.readChar()
+            tok = token.Token{Type: token.SHL, Literal: "<<"}
+        default:
+            tok = token.NewToken(token.LT, l.ch)
+        }
     case '>':
-        tok = token.NewToken(token.GT, l.ch)
+        switch l.peekChar() {
+        case '=':
+            l.readChar()
+            tok = token.Token{Type: token.GT_EQ, Literal: ">="}
+        case '>':
+            l.readChar()
+            tok = token.Token{Type: token.SHR, Literal: ">>"}
+        default:
+            tok = token.NewToken(token.GT, l.ch)
+        }
     case ':':
         tok = token.NewToken(token.COLON, l.ch)
+    case '.':
+        if strings.HasPrefix(l.input[l.position:], "...") {
+            l.readChar()
+            l.readChar()
+            tok = token.Token{Type: token.ELLIPSIS, Literal: "..."}
+        } else {
+            tok = token.NewToken(token.DOT, l.ch)
+        }
 	case ';':
 		tok = token.NewToken(token.SEMICOLON, l.ch)
 	case '(':
@@ -73,7 +164,21 @@ func (l *Lexer) NextToken() token.Token {
 		tok = token.NewToken(token.COMMA, l.ch)
 	case '{':
 		tok = token.NewToken(token.LBRACE, l.ch)
+		if len(l.interp) > 0 {
+			l.interp[len(l.interp)-1]++
+		}
 	case '}':
+		if len(l.interp) > 0 && l.interp[len(l.interp)-1] == 0 {
+			// the end of a ${...}, the rest of the string follows
+			l.interp = l.interp[:len(l.interp)-1]
+			l.readChar()
+			tok = l.readStringToken(token.INTERP_MID, token.INTERP_END)
+			break
+		}
+
+		if len(l.interp) > 0 {
+			l.interp[len(l.interp)-1]--
+		}
 		tok = token.NewToken(token.RBRACE, l.ch)
     case '[':
         tok = token.NewToken(token.LBRACKET, l.ch)
@@ -81,8 +186,19 @@ func (l *Lexer) NextToken() token.Token {
         tok = token.NewToken(token.RBRACKET, l.ch)
     case '"':
         l.readChar()
-        tok.Literal = l.readStringLiteral()
-        tok.Type = token.STRING
+        tok = l.readStringToken(token.INTERP_START, token.STRING)
+    case '`':
+        l.readChar()
+        position := l.position
+        for l.ch != '`' && l.ch != 0 {
+            l.readChar()
+        }
+
+        if l.ch == 0 {
+            tok = token.Token{Type: token.ILLEGAL, Literal: "unterminated raw string literal"}
+        } else {
+            tok = token.Token{Type: token.STRING, Literal: l.input[position:l.position]}
+        }
 	case 0:
 		tok.Literal = ""
 		tok.Type = token.EOF
@@ -90,10 +206,13 @@ func (l *Lexer) NextToken() token.Token {
 		if isLetter(l.ch) {
 			tok.Literal = l.readIdentifier() // could be keyword
 			tok.Type = token.LookupIndentifier(tok.Literal)
+			tok.Pos = pos
+			tok.Comments = comments
 			return tok // early return because we already move to next char from readIdentifier()
 		} else if isDigit(l.ch) {
-			tok.Literal = l.readNumber()
-			tok.Type = token.INT
+			tok.Literal, tok.Type = l.readNumber()
+			tok.Pos = pos
+			tok.Comments = comments
 			return tok // early return. same reason as the previous block
 		} else {
 			tok = token.NewToken(token.ILLEGAL, l.ch)
@@ -101,33 +220,205 @@ func (l *Lexer) NextToken() token.Token {
 	}
 
 	l.readChar()
+	tok.Pos = pos
+	tok.Comments = comments
 	return tok
 }
 
 func (l *Lexer) readIdentifier() string {
 	position := l.position
-	for isLetter(l.ch) {
+	for isLetter(l.ch) || isIdentifierMark(l.ch) {
 		l.readChar()
 	}
 	return l.input[position:l.position] // genius!
 }
 
-func (l *Lexer) readNumber() string {
+// reads an integer, or a float if a fraction or an exponent follows the digits
+func (l *Lexer) readNumber() (string, token.TokenType) {
 	position := l.position
+	tokType := token.TokenType(token.INT)
+
+	l.readDigits()
+
+	if l.ch == '.' && isDigit(l.peekChar()) {
+		tokType = token.FLOAT
+		l.readChar()
+		l.readDigits()
+	}
+
+	if l.ch == 'e' || l.ch == 'E' {
+		// only an exponent if digits follow, otherwise the e starts an identifier
+		offset := 1
+		if next := l.peekChar(); next == '+' || next == '-' {
+			offset = 2
+		}
+
+		if l.position+offset < len(l.input) && isDigit(rune(l.input[l.position+offset])) {
+			tokType = token.FLOAT
+			for i := 0; i < offset; i++ {
+				l.readChar()
+			}
+			l.readDigits()
+		}
+	}
+
+	return l.input[position:l.position], tokType
+}
+
+func (l *Lexer) readDigits() {
 	for isDigit(l.ch) {
 		l.readChar()
 	}
-	return l.input[position:l.position]
 }
 
-func (l *Lexer) readStringLiteral() string {
-    position := l.position
-    
-    for l.ch != '"' && l.ch != 0 {
+// interpType is the type of the token if the text ends with a ${, endType if it ends the string
+func (l *Lexer) readStringToken(interpType, endType token.TokenType) token.Token {
+    literal, msg, interpolated := l.readStringLiteral()
+
+    if interpolated {
+        l.interp = append(l.interp, 0)
+    }
+
+    switch {
+    case msg != "":
+        return token.Token{Type: token.ILLEGAL, Literal: msg}
+    case interpolated:
+        return token.Token{Type: interpType, Literal: literal}
+    default:
+        return token.Token{Type: endType, Literal: literal}
+    }
+}
+
+// reads a "..." string up to the closing quote, or up to a ${ in which case interpolated
+// is true, and processes its escape sequences. msg describes the problem if the literal
+// is malformed. a string can't span lines, so a missing quote doesn't swallow the rest of the file
+func (l *Lexer) readStringLiteral() (literal string, msg string, interpolated bool) {
+    var out strings.Builder
+
+    for ; l.ch != '"'; l.readChar() {
+        if l.ch == 0 || l.ch == '\n' {
+            return "", "unterminated string literal", false
+        }
+
+        if l.ch == '$' && l.peekChar() == '{' {
+            l.readChar() // NextToken skips the {
+            return out.String(), msg, true
+        }
+
+        if l.ch != '\\' {
+            out.WriteRune(l.ch)
+            continue
+        }
+
         l.readChar()
+        if l.ch == 0 || l.ch == '\n' {
+            return "", "unterminated string literal", false
+        }
+
+        escape := l.ch
+        value, ok := l.readEscape()
+        if !ok && msg == "" {
+            // keep going to the closing quote so the tokens after the string are still fine
+            msg = fmt.Sprintf("invalid escape sequence \\%c in string literal", escape)
+        }
+        out.WriteString(value)
     }
 
-    return l.input[position:l.position]
+    return out.String(), msg, false
+}
+
+// reads the escape sequence after a backslash, leaving l.ch on its last character
+func (l *Lexer) readEscape() (string, bool) {
+    switch l.ch {
+    case 'n':
+        return "\n", true
+    case 't':
+        return "\t", true
+    case 'r':
+        return "\r", true
+    case '0':
+        return "\x00", true
+    case '\\', '"', '\'', '$':
+        return string(l.ch), true
+    case 'x':
+        return l.readHexEscape(2, false)
+    case 'u':
+        return l.readHexEscape(4, true)
+    case 'U':
+        return l.readHexEscape(8, true)
+    }
+
+    return "", false
+}
+
+// \xHH gives a single byte, \uHHHH and \UHHHHHHHH give the UTF-8 encoding of a code point
+func (l *Lexer) readHexEscape(digits int, isRune bool) (string, bool) {
+    value := 0
+    for i := 0; i < digits; i++ {
+        digit := hexValue(l.peekChar())
+        if digit < 0 {
+            return "", false
+        }
+        l.readChar()
+        value = value*16 + digit
+    }
+
+    if !isRune {
+        return string([]byte{byte(value)}), true
+    }
+
+    if !utf8.ValidRune(rune(value)) {
+        return "", false
+    }
+    return string(rune(value)), true
+}
+
+func hexValue(ch rune) int {
+    switch {
+    case '0' <= ch && ch <= '9':
+        return int(ch - '0')
+    case 'a' <= ch && ch <= 'f':
+        return int(ch - 'a' + 10)
+    case 'A' <= ch && ch <= 'F':
+        return int(ch - 'A' + 10)
+    }
+    return -1
+}
+
+// reads a // comment up to the end of the line, or a /* */ comment which can be nested.
+// ok is false if a block comment is never closed
+func (l *Lexer) readComment() (comment token.Comment, ok bool) {
+	comment.Pos = l.currentPosition()
+	position := l.position
+
+	if l.peekChar() == '/' {
+		for l.ch != '\n' && l.ch != 0 {
+			l.readChar()
+		}
+		comment.Text = l.input[position:l.position]
+		return comment, true
+	}
+
+	depth := 0
+	for {
+		switch {
+		case l.ch == 0:
+			comment.Text = l.input[position:l.position]
+			return comment, false
+		case l.ch == '/' && l.peekChar() == '*':
+			depth++
+			l.readChar()
+		case l.ch == '*' && l.peekChar() == '/':
+			depth--
+			l.readChar()
+		}
+		l.readChar()
+
+		if depth == 0 {
+			comment.Text = l.input[position:l.position]
+			return comment, true
+		}
+	}
 }
 
 func (l *Lexer) skipWhitespace() {
@@ -136,18 +427,25 @@ func (l *Lexer) skipWhitespace() {
 	}
 }
 
-func (l *Lexer) peekChar() byte {
+func (l *Lexer) peekChar() rune {
     if l.readPosition >= len(l.input) {
         return 0
     } else {
-        return l.input[l.readPosition]
+        ch, _ := utf8.DecodeRuneInString(l.input[l.readPosition:])
+        return ch
     }
 }
 
-func isLetter(ch byte) bool {
-	return 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || ch == '_' // neat
+func isLetter(ch rune) bool {
+	return unicode.IsLetter(ch) || ch == '_' // any script, not just ASCII
+}
+
+// marks (like Arabic and Persian diacritics) and the zero width (non-)joiner can't start
+// an identifier but may appear inside one
+func isIdentifierMark(ch rune) bool {
+	return unicode.IsMark(ch) || ch == '\u200c' || ch == '\u200d'
 }
 
-func isDigit(ch byte) bool {
+func isDigit(ch rune) bool {
 	return '0' <= ch && ch <= '9'
 }
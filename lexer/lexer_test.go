@@ -13,7 +13,7 @@ func TestNextToken(t *testing.T) {
             x + y;
             };
             let result = add(five, ten);
-            !-/*5;
+            !-/ *5;
             5 < 10 > 5;
             if (5 < 10) {
                 return true;
@@ -27,6 +27,14 @@ func TestNextToken(t *testing.T) {
             ""
             [1, 2]
             {"mate": "mamad"}
+            while (x) { break; continue; }
+            for (k, v in x) {}
+            3.14 1e3 2.5E-2 7e+1 4.e 1ex
+            a && b || c
+            <= >= % & | ^ ~ << >>
+            [a, ...b] .. .
+            import "lib.monkey" export m.f
+            match (x) { _ => 1 } = => ==
             `
 
 	tests := []struct {
@@ -119,6 +127,76 @@ func TestNextToken(t *testing.T) {
         {token.COLON, ":"},
         {token.STRING, "mamad"},
         {token.RBRACE, "}"},
+        {token.WHILE, "while"},
+        {token.LPAREN, "("},
+        {token.IDENT, "x"},
+        {token.RPAREN, ")"},
+        {token.LBRACE, "{"},
+        {token.BREAK, "break"},
+        {token.SEMICOLON, ";"},
+        {token.CONTINUE, "continue"},
+        {token.SEMICOLON, ";"},
+        {token.RBRACE, "}"},
+        {token.FOR, "for"},
+        {token.LPAREN, "("},
+        {token.IDENT, "k"},
+        {token.COMMA, ","},
+        {token.IDENT, "v"},
+        {token.IN, "in"},
+        {token.IDENT, "x"},
+        {token.RPAREN, ")"},
+        {token.LBRACE, "{"},
+        {token.RBRACE, "}"},
+        {token.FLOAT, "3.14"},
+        {token.FLOAT, "1e3"},
+        {token.FLOAT, "2.5E-2"},
+        {token.FLOAT, "7e+1"},
+        {token.INT, "4"},
+        {token.DOT, "."},
+        {token.IDENT, "e"},
+        {token.INT, "1"},
+        {token.IDENT, "ex"},
+        {token.IDENT, "a"},
+        {token.AND, "&&"},
+        {token.IDENT, "b"},
+        {token.OR, "||"},
+        {token.IDENT, "c"},
+        {token.LT_EQ, "<="},
+        {token.GT_EQ, ">="},
+        {token.PERCENT, "%"},
+        {token.AMPERSAND, "&"},
+        {token.PIPE, "|"},
+        {token.CARET, "^"},
+        {token.TILDE, "~"},
+        {token.SHL, "<<"},
+        {token.SHR, ">>"},
+        {token.LBRACKET, "["},
+        {token.IDENT, "a"},
+        {token.COMMA, ","},
+        {token.ELLIPSIS, "..."},
+        {token.IDENT, "b"},
+        {token.RBRACKET, "]"},
+        {token.DOT, "."},
+        {token.DOT, "."},
+        {token.DOT, "."},
+        {token.IMPORT, "import"},
+        {token.STRING, "lib.monkey"},
+        {token.EXPORT, "export"},
+        {token.IDENT, "m"},
+        {token.DOT, "."},
+        {token.IDENT, "f"},
+        {token.MATCH, "match"},
+        {token.LPAREN, "("},
+        {token.IDENT, "x"},
+        {token.RPAREN, ")"},
+        {token.LBRACE, "{"},
+        {token.IDENT, "_"},
+        {token.ARROW, "=>"},
+        {token.INT, "1"},
+        {token.RBRACE, "}"},
+        {token.ASSIGN, "="},
+        {token.ARROW, "=>"},
+        {token.EQ, "=="},
 		{token.EOF, ""},
 	}
 
@@ -138,3 +216,256 @@ func TestNextToken(t *testing.T) {
 		}
 	}
 }
+
+func TestTokenPositions(t *testing.T) {
+	input := "let x = 5;\n  \"hi\" + x\n\nfoo"
+
+	tests := []struct {
+		expectedType   token.TokenType
+		expectedLine   int
+		expectedColumn int
+	}{
+		{token.LET, 1, 1},
+		{token.IDENT, 1, 5},
+		{token.ASSIGN, 1, 7},
+		{token.INT, 1, 9},
+		{token.SEMICOLON, 1, 10},
+		{token.STRING, 2, 3},
+		{token.PLUS, 2, 8},
+		{token.IDENT, 2, 10},
+		{token.IDENT, 4, 1},
+		{token.EOF, 4, 4},
+	}
+
+	lex := NewLexerWithFile(input, "test.monkey")
+
+	for i, tt := range tests {
+		tok := lex.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Pos.Line != tt.expectedLine || tok.Pos.Column != tt.expectedColumn {
+			t.Fatalf("tests[%d] - position wrong. expected=%d:%d, got=%d:%d",
+				i, tt.expectedLine, tt.expectedColumn, tok.Pos.Line, tok.Pos.Column)
+		}
+
+		if tok.Pos.File != "test.monkey" {
+			t.Fatalf("tests[%d] - file wrong. expected=%q, got=%q", i, "test.monkey", tok.Pos.File)
+		}
+	}
+}
+
+func TestComments(t *testing.T) {
+	input := `// leading
+let x = 5; // trailing
+/* block /* nested */ still block */ x
+10 / 2 /* at the end */`
+
+	tests := []struct {
+		expectedType     token.TokenType
+		expectedLiteral  string
+		expectedComments []string
+	}{
+		{token.LET, "let", []string{"// leading"}},
+		{token.IDENT, "x", nil},
+		{token.ASSIGN, "=", nil},
+		{token.INT, "5", nil},
+		{token.SEMICOLON, ";", nil},
+		{token.IDENT, "x", []string{"// trailing", "/* block /* nested */ still block */"}},
+		{token.INT, "10", nil},
+		{token.SLASH, "/", nil},
+		{token.INT, "2", nil},
+		{token.EOF, "", []string{"/* at the end */"}},
+	}
+
+	lex := NewLexer(input)
+
+	for i, tt := range tests {
+		tok := lex.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+
+		if len(tok.Comments) != len(tt.expectedComments) {
+			t.Fatalf("tests[%d] - wrong number of comments. expected=%d, got=%d", i, len(tt.expectedComments), len(tok.Comments))
+		}
+
+		for j, text := range tt.expectedComments {
+			if tok.Comments[j].Text != text {
+				t.Errorf("tests[%d] - comment %d wrong. expected=%q, got=%q", i, j, text, tok.Comments[j].Text)
+			}
+		}
+	}
+}
+
+func TestCommentPositions(t *testing.T) {
+	lex := NewLexer("x\n  // hi\ny")
+	lex.NextToken()
+
+	tok := lex.NextToken()
+	if len(tok.Comments) != 1 {
+		t.Fatalf("wrong number of comments. expected=1, got=%d", len(tok.Comments))
+	}
+
+	if pos := tok.Comments[0].Pos; pos.Line != 2 || pos.Column != 3 {
+		t.Errorf("comment position wrong. expected=2:3, got=%d:%d", pos.Line, pos.Column)
+	}
+}
+
+func TestUnterminatedBlockComment(t *testing.T) {
+	lex := NewLexer("1 /* never /* closed */")
+	lex.NextToken()
+
+	tok := lex.NextToken()
+	if tok.Type != token.ILLEGAL {
+		t.Fatalf("tokentype wrong. expected=%q, got=%q", token.ILLEGAL, tok.Type)
+	}
+
+	if tok.Literal != "unterminated block comment" {
+		t.Errorf("literal wrong. got=%q", tok.Literal)
+	}
+
+	if tok.Pos.Line != 1 || tok.Pos.Column != 3 {
+		t.Errorf("position wrong. expected=1:3, got=%d:%d", tok.Pos.Line, tok.Pos.Column)
+	}
+}
+
+func TestStringLiterals(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{`"plain"`, token.STRING, "plain"},
+		{`"a\nb\tc\r"`, token.STRING, "a\nb\tc\r"},
+		{`"say \"hi\" \\ 'there'"`, token.STRING, `say "hi" \ 'there'`},
+		{`"it\'s\0"`, token.STRING, "it's\x00"},
+		{`"\x41\u00e9\U0001F600"`, token.STRING, "Aé😀"},
+		{"`raw \\n \"string\"`", token.STRING, `raw \n "string"`},
+		{"`multi\nline`", token.STRING, "multi\nline"},
+		{`"no end`, token.ILLEGAL, "unterminated string literal"},
+		{"\"no end\nx\"", token.ILLEGAL, "unterminated string literal"},
+		{`"trailing \`, token.ILLEGAL, "unterminated string literal"},
+		{"`no end", token.ILLEGAL, "unterminated raw string literal"},
+		{`"bad \q escape"`, token.ILLEGAL, `invalid escape sequence \q in string literal`},
+		{`"\x4"`, token.ILLEGAL, `invalid escape sequence \x in string literal`},
+		{`"\uD800"`, token.ILLEGAL, `invalid escape sequence \u in string literal`},
+	}
+
+	for i, tt := range tests {
+		tok := NewLexer(tt.input).NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Errorf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Errorf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestTokensAfterBadString(t *testing.T) {
+	lex := NewLexer("\"bad \\q\" + 1\n\"unterminated\nlet")
+
+	expected := []token.TokenType{token.ILLEGAL, token.PLUS, token.INT, token.ILLEGAL, token.LET, token.EOF}
+	for i, tokType := range expected {
+		tok := lex.NextToken()
+		if tok.Type != tokType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tokType, tok.Type)
+		}
+	}
+}
+
+func TestInterpolatedStrings(t *testing.T) {
+	input := `"a ${x + 1} b ${ {"k": "}"}["k"] }${"in ${y}"}" "\${no}" "$ {no}"`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.INTERP_START, "a "},
+		{token.IDENT, "x"},
+		{token.PLUS, "+"},
+		{token.INT, "1"},
+		{token.INTERP_MID, " b "},
+		{token.LBRACE, "{"},
+		{token.STRING, "k"},
+		{token.COLON, ":"},
+		{token.STRING, "}"},
+		{token.RBRACE, "}"},
+		{token.LBRACKET, "["},
+		{token.STRING, "k"},
+		{token.RBRACKET, "]"},
+		{token.INTERP_MID, ""},
+		{token.INTERP_START, "in "},
+		{token.IDENT, "y"},
+		{token.INTERP_END, ""},
+		{token.INTERP_END, ""},
+		{token.STRING, "${no}"},
+		{token.STRING, "$ {no}"},
+		{token.EOF, ""},
+	}
+
+	lex := NewLexer(input)
+
+	for i, tt := range tests {
+		tok := lex.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestUnicodeInput(t *testing.T) {
+	input := "let سلام = \"héllo 😀\";\nnام‌ها + ñ1 €"
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+		expectedColumn  int
+	}{
+		{token.LET, "let", 1},
+		{token.IDENT, "سلام", 5},
+		{token.ASSIGN, "=", 10},
+		{token.STRING, "héllo 😀", 12},
+		{token.SEMICOLON, ";", 21},
+		{token.IDENT, "nام‌ها", 1},
+		{token.PLUS, "+", 8},
+		{token.IDENT, "ñ", 10},
+		{token.INT, "1", 11},
+		{token.ILLEGAL, "€", 13},
+		{token.EOF, "", 14},
+	}
+
+	lex := NewLexer(input)
+
+	for i, tt := range tests {
+		tok := lex.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+
+		if tok.Pos.Column != tt.expectedColumn {
+			t.Fatalf("tests[%d] - column wrong. expected=%d, got=%d", i, tt.expectedColumn, tok.Pos.Column)
+		}
+	}
+}
@@ -1,28 +1,103 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"log"
 	"monkey/repl"
 	"os"
 	"os/user"
     "monkey/file"
+    "monkey/vm"
 )
 
+const usage = `usage:
+    monkey                                          start the REPL
+    monkey repl [LIMITS]                            start the REPL with other vm limits
+    monkey run [--engine=vm|eval] [LIMITS] FILE     run a monkey file
+    monkey --help                                   show this
+
+limits of the vm, raise them for deep recursion that isn't in tail position:
+    --max-stack=N       slots of the stack (default 2048)
+    --max-frames=N      how deep calls can go (default 1024)
+`
+
 func main() {
+    args := os.Args[1:]
+
+    if len(args) == 0 {
+        startRepl(vm.Options{})
+        return
+    }
+
+    switch args[0] {
+    case "-h", "-help", "--help", "help":
+        fmt.Print(usage)
+        return
+    }
+
+    if args[0] == "repl" {
+        replCmd := flag.NewFlagSet("repl", flag.ExitOnError)
+        replCmd.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+        opts := limitFlags(replCmd)
+        replCmd.Parse(args[1:])
+
+        if replCmd.NArg() != 0 || !validLimits(opts) {
+            replCmd.Usage()
+            os.Exit(file.ExitUsage)
+        }
+
+        startRepl(*opts)
+        return
+    }
+
+    if args[0] != "run" {
+        // kept for backwards compatibility: monkey path/to/file
+        if len(args) == 1 {
+            runFile(args[0], file.EngineVM)
+        }
+
+        fmt.Fprint(os.Stderr, usage)
+        os.Exit(file.ExitUsage)
+    }
+
+    runCmd := flag.NewFlagSet("run", flag.ExitOnError)
+    runCmd.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+    engine := runCmd.String("engine", file.EngineVM, "engine used to run the file: vm or eval")
+    opts := limitFlags(runCmd)
+    runCmd.Parse(args[1:])
+
+    if runCmd.NArg() != 1 || (*engine != file.EngineVM && *engine != file.EngineEval) || !validLimits(opts) {
+        runCmd.Usage()
+        os.Exit(file.ExitUsage)
+    }
+
+    os.Exit(file.Run_file_With_Options(runCmd.Arg(0), *engine, *opts, os.Stderr))
+}
+
+func startRepl(opts vm.Options) {
     user, err := user.Current()
     if err != nil {
         log.Fatal(err)
     }
-    args := os.Args
-
-    if len(args) == 2 {
-        file.Run_file(args[1])
-    } else {
-        fmt.Printf("Hello %s. KYS\n", user.Username)
-        fmt.Printf("enter commands:\n")
-        repl.Start(os.Stdin, os.Stdout)
-    }
+
+    fmt.Printf("Hello %s. KYS\n", user.Username)
+    fmt.Printf("enter commands:\n")
+    repl.Start_With_Options(os.Stdin, os.Stdout, opts)
+}
+
+func runFile(path string, engine string) {
+    os.Exit(file.Run_file(path, engine, os.Stderr))
 }
 
+// the --max-stack and --max-frames flags, both default to the vm's own limits
+func limitFlags(flags *flag.FlagSet) *vm.Options {
+    opts := &vm.Options{}
+    flags.IntVar(&opts.MaxStackSize, "max-stack", vm.StackSize, "slots of the vm's stack")
+    flags.IntVar(&opts.MaxFrames, "max-frames", vm.MaxFrames, "how deep calls can go in the vm")
+    return opts
+}
 
+func validLimits(opts *vm.Options) bool {
+    return opts.MaxStackSize > 0 && opts.MaxFrames > 0
+}
@@ -0,0 +1,83 @@
+package module
+
+import (
+    "fmt"
+    "monkey/ast"
+    "monkey/lexer"
+    "monkey/parser"
+    "monkey/token"
+    "os"
+    "path/filepath"
+    "strings"
+)
+
+// Resolve gives the path of an imported file, relative paths are relative to the file with the import.
+// the result is also what the engines cache modules by.
+func Resolve(path string, from token.Position) string {
+    if filepath.IsAbs(path) {
+        return filepath.Clean(path)
+    }
+    return filepath.Join(filepath.Dir(from.File), path)
+}
+
+// Parse reads and parses a module, the tokens of the module know which file they come from
+func Parse(path string) (*ast.Program, error) {
+    source, err := os.ReadFile(path)
+    if err != nil {
+        return nil, fmt.Errorf("cannot import %s: %s", path, errorReason(err))
+    }
+
+    p := parser.NewParser(lexer.NewLexerWithFile(string(source), path))
+    program := p.ParseProgram()
+
+    // the first syntax error is the one that matters, the rest usually follow from it
+    if len(p.Errors()) != 0 {
+        return nil, fmt.Errorf("cannot import %s: %s", path, p.Errors()[0])
+    }
+
+    return program, nil
+}
+
+// Chain is the modules being loaded right now, so an import cycle is an error instead of
+// an endless loop. the file with the first import starts the chain.
+type Chain struct {
+    paths []string
+    rooted bool // paths[0] is the importing file, not a module being loaded
+}
+
+// Enter puts path on the chain, from is where the import is
+func (c *Chain) Enter(from token.Position, path string) error {
+    paths := c.paths
+    rooted := c.rooted
+    if len(paths) == 0 && from.File != "" {
+        paths = []string{filepath.Clean(from.File)}
+        rooted = true
+    }
+
+    for _, p := range paths {
+        if p == path {
+            return fmt.Errorf("import cycle: %s -> %s", strings.Join(paths, " -> "), path)
+        }
+    }
+
+    c.paths = append(paths, path)
+    c.rooted = rooted
+    return nil
+}
+
+// Leave takes the module that was loaded last off the chain
+func (c *Chain) Leave() {
+    c.paths = c.paths[:len(c.paths)-1]
+
+    if c.rooted && len(c.paths) == 1 {
+        c.paths = nil
+        c.rooted = false
+    }
+}
+
+func errorReason(err error) string {
+    if pathErr, ok := err.(*os.PathError); ok {
+        return pathErr.Err.Error()
+    }
+    return err.Error()
+}
@@ -0,0 +1,220 @@
+package object
+
+import (
+    "fmt"
+    "math"
+    "strconv"
+    "strings"
+    "unicode/utf8"
+)
+
+// Builtins is shared by the evaluator and the compiler/VM. The compiler refers to
+// builtins by their index in this slice, so new entries should only be appended.
+var Builtins = []struct {
+    Name string
+    Builtin *Builtin
+}{
+    {
+        "len",
+        &Builtin{Fn: func(args ...Object) Object {
+            if len(args) != 1 {
+                return newError("wrong number of arguments. got=%d, want=1", len(args))
+            }
+
+            switch arg := args[0].(type) {
+            case *String: // characters, not bytes
+                return &Integer{Value: int64(utf8.RuneCountInString(arg.Value))}
+            case *Array:
+                return &Integer{Value: int64(len(arg.Elements))}
+            case *HashMap:
+                return &Integer{Value: int64(len(arg.Pairs))}
+            default:
+                return newError("argument to `len` not supported, got %s", args[0].Type())
+            }
+        },
+        },
+    },
+    { // it is done in O(n) time
+        "ordered_remove",
+        &Builtin{Fn: func(args ...Object) Object {
+            if len(args) != 2 {
+                return newError("wrong number of arguments. got=%d, want=2", len(args))
+            }
+
+            if args[0].Type() != ARRAY_OBJ {
+                return newError("first argument to `ordered_remove` must be ARRAY, got %s", args[0].Type())
+            }
+
+            if args[1].Type() != INTEGER_OBJ {
+                return newError("second argument to `ordered_remove` must be INTEGER, got %s", args[1].Type())
+            }
+
+            arr := args[0].(*Array)
+            idx := args[1].(*Integer).Value
+
+            if idx >= int64(len(arr.Elements)) || idx < 0 {
+                return newError("index out of bounds")
+            }
+            
+            arr.Elements = append(arr.Elements[:idx], arr.Elements[idx+1:]...)
+
+            return arr
+        },
+        },
+    },
+    { // it is done in O(1) time
+        "unordered_remove",
+        &Builtin{Fn: func(args ...Object) Object {
+            if len(args) != 2 {
+                return newError("wrong number of arguments. got=%d, want=2", len(args))
+            }
+
+            if args[0].Type() != ARRAY_OBJ {
+                return newError("first argument to `ordered_remove` must be ARRAY, got %s", args[0].Type())
+            }
+
+            if args[1].Type() != INTEGER_OBJ {
+                return newError("second argument to `ordered_remove` must be INTEGER, got %s", args[1].Type())
+            }
+
+            arr := args[0].(*Array)
+            idx := args[1].(*Integer).Value
+
+            if idx >= int64(len(arr.Elements)) || idx < 0 {
+                return newError("index out of bounds")
+            }
+            
+            arr.Elements[idx] = arr.Elements[len(arr.Elements)-1]
+            arr.Elements = arr.Elements[:len(arr.Elements)-1]
+
+            return arr
+        },
+        },
+    },
+    {
+        "append",
+        &Builtin{Fn: func(args ...Object) Object {
+            if len(args) != 2 {
+                return newError("wrong number of arguments. got=%d, want=2", len(args))
+            }
+
+            if args[0].Type() != ARRAY_OBJ {
+                return newError("first argument to `append` must be ARRAY, got %s", args[0].Type())
+            }
+
+            arr := args[0].(*Array)
+            arr.Elements = append(arr.Elements, args[1])
+
+            return arr
+        },
+        },
+    },
+    {
+        "insert",
+        &Builtin{Fn: func(args ...Object) Object {
+            if len(args) != 3 {
+                return newError("wrong number of arguments. got=%d, want=3", len(args))
+            }
+
+            if args[0].Type() != ARRAY_OBJ {
+                return newError("first argument to `insert` must be ARRAY, got %s", args[0].Type())
+            }
+
+            if args[1].Type() != INTEGER_OBJ {
+                return newError("second argument to `insert` must be INTEGER, got %s", args[1].Type())
+            }
+
+            arr := args[0].(*Array)
+            idx := args[1].(*Integer).Value
+
+            if idx >= int64(len(arr.Elements)) || idx < 0 {
+                return newError("index out of bounds")
+            }
+
+            arr.Elements = append(arr.Elements[:idx], append([]Object{args[2]}, arr.Elements[idx:]...)...)
+
+            return arr
+        },
+        },
+    },
+    {
+        "puts",
+        &Builtin{Fn: func(args ...Object) Object {
+            for _, arg := range args {
+                fmt.Println(arg.Inspect())
+            }
+            return nil
+        },
+        },
+    },
+    { // floats are truncated towards zero
+        "int",
+        &Builtin{Fn: func(args ...Object) Object {
+            if len(args) != 1 {
+                return newError("wrong number of arguments. got=%d, want=1", len(args))
+            }
+
+            switch arg := args[0].(type) {
+            case *Integer:
+                return arg
+            case *Float:
+                if math.IsNaN(arg.Value) || math.IsInf(arg.Value, 0) {
+                    return newError("cannot convert %s to INTEGER", arg.Inspect())
+                }
+                return &Integer{Value: int64(arg.Value)}
+            case *String:
+                value, err := strconv.ParseInt(strings.TrimSpace(arg.Value), 10, 64)
+                if err != nil {
+                    return newError("could not parse %q as integer", arg.Value)
+                }
+                return &Integer{Value: value}
+            default:
+                return newError("argument to `int` not supported, got %s", args[0].Type())
+            }
+        },
+        },
+    },
+    {
+        "float",
+        &Builtin{Fn: func(args ...Object) Object {
+            if len(args) != 1 {
+                return newError("wrong number of arguments. got=%d, want=1", len(args))
+            }
+
+            switch arg := args[0].(type) {
+            case *Integer:
+                return &Float{Value: float64(arg.Value)}
+            case *Float:
+                return arg
+            case *String:
+                value, err := strconv.ParseFloat(strings.TrimSpace(arg.Value), 64)
+                if err != nil {
+                    return newError("could not parse %q as float", arg.Value)
+                }
+                return &Float{Value: value}
+            default:
+                return newError("argument to `float` not supported, got %s", args[0].Type())
+            }
+        },
+        },
+    },
+    {
+        "str",
+        &Builtin{Fn: func(args ...Object) Object {
+            if len(args) != 1 {
+                return newError("wrong number of arguments. got=%d, want=1", len(args))
+            }
+
+            if arg, ok := args[0].(*String); ok {
+                return arg
+            }
+
+            return &String{Value: args[0].Inspect()}
+        },
+        },
+    },
+}
+
+func newError(format string, a ...interface{}) *Error {
+    return &Error{Message: fmt.Sprintf(format, a...)}
+}
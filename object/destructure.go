@@ -0,0 +1,51 @@
+package object
+
+import "fmt"
+
+// the evaluator and the vm both destructure through these, so a let [a, b] = ... fails the same way on both
+
+// UnpackArray returns the first n elements of an array, followed by a new array of the
+// remaining ones when rest is set. Without a rest the array must have exactly n elements.
+func UnpackArray(obj Object, n int, rest bool) ([]Object, error) {
+    arr, ok := obj.(*Array)
+    if !ok {
+        return nil, fmt.Errorf("cannot destructure %s as an array", obj.Type())
+    }
+
+    if rest && len(arr.Elements) < n {
+        return nil, fmt.Errorf("not enough elements to destructure: want at least %d, got %d", n, len(arr.Elements))
+    }
+    if !rest && len(arr.Elements) != n {
+        return nil, fmt.Errorf("wrong number of elements to destructure: want %d, got %d", n, len(arr.Elements))
+    }
+
+    values := make([]Object, n, n + 1)
+    copy(values, arr.Elements)
+
+    if rest {
+        remaining := make([]Object, len(arr.Elements) - n)
+        copy(remaining, arr.Elements[n:])
+        values = append(values, &Array{Elements: remaining})
+    }
+
+    return values, nil
+}
+
+// UnpackHash looks up each key as a string in a hash map, a missing key is an error
+func UnpackHash(obj Object, keys []string) ([]Object, error) {
+    hash, ok := obj.(*HashMap)
+    if !ok {
+        return nil, fmt.Errorf("cannot destructure %s as a hash map", obj.Type())
+    }
+
+    values := make([]Object, len(keys))
+    for i, key := range keys {
+        pair, ok := hash.Pairs[(&String{Value: key}).HashKey()]
+        if !ok {
+            return nil, fmt.Errorf("key %q not found in hash map", key)
+        }
+        values[i] = pair.Value
+    }
+
+    return values, nil
+}
@@ -1,13 +1,35 @@
 package object
 
+import "monkey/module"
+
 type Environment struct {
     store map[string]Object
     outer *Environment
+    functionName string // the function this is a call of, like the vm its name can't be assigned to
+    modules *ModuleCache // shared by every environment of a run
+}
+
+// ModuleCache has the modules a run imported so each file is only evaluated once
+type ModuleCache struct {
+    Loaded map[string]*Module // by resolved path
+    Loading module.Chain
 }
 
 func NewEnvironment() *Environment {
     s := make(map[string]Object)
-    return &Environment{store: s, outer: nil}
+    modules := &ModuleCache{Loaded: map[string]*Module{}}
+    return &Environment{store: s, outer: nil, modules: modules}
+}
+
+// NewModuleEnvironment is the top level scope of an imported file, it only shares the module cache with the importer
+func NewModuleEnvironment(importer *Environment) *Environment {
+    env := NewEnvironment()
+    env.modules = importer.modules
+    return env
+}
+
+func (e *Environment) Modules() *ModuleCache {
+    return e.modules
 }
 
 func (e *Environment) Get(name string) (Object, bool) {
@@ -23,8 +45,45 @@ func (e *Environment) Set(name string, value Object) Object {
     return value
 }
 
+// Assign changes an existing binding in the innermost scope that has it,
+// ok is false if the name was never declared
+func (e *Environment) Assign(name string, value Object) (Object, bool) {
+    if _, ok := e.store[name]; ok {
+        e.store[name] = value
+        return value, true
+    }
+
+    if e.outer != nil {
+        return e.outer.Assign(name, value)
+    }
+
+    return nil, false
+}
+
+func (e *Environment) SetFunctionName(name string) {
+    e.functionName = name
+}
+
+// IsFunctionName reports whether name refers to a function from inside its own body
+func (e *Environment) IsFunctionName(name string) bool {
+    if _, ok := e.store[name]; ok {
+        return false
+    }
+
+    if e.functionName != "" && e.functionName == name {
+        return true
+    }
+
+    if e.outer != nil {
+        return e.outer.IsFunctionName(name)
+    }
+
+    return false
+}
+
 func NewEnclosedEnvironment(outer *Environment) *Environment {
     env := NewEnvironment()
     env.outer = outer
+    env.modules = outer.modules
     return env
 }
@@ -0,0 +1,57 @@
+package object
+
+import "monkey/token"
+
+// NewException is what a catch gets for a runtime error, a hash map like
+// {"message": "division by zero", "line": 3, "column": 7}. "line", "column" and "file"
+// are only there when the error has a location.
+func NewException(message string, pos token.Position) *HashMap {
+    exception := &HashMap{Pairs: map[HashKey]HashPair{}}
+    exception.set("message", &String{Value: message})
+
+    if pos.IsValid() {
+        exception.set("line", &Integer{Value: int64(pos.Line)})
+        exception.set("column", &Integer{Value: int64(pos.Column)})
+        if pos.File != "" {
+            exception.set("file", &String{Value: pos.File})
+        }
+    }
+
+    return exception
+}
+
+// UncaughtException gives the error message and location of a thrown value nobody caught.
+// anything with a "message" keeps its own message (and location, if it has one), so an
+// exception that's caught and thrown again still looks like the original error.
+func UncaughtException(value Object, pos token.Position) (string, token.Position) {
+    hash, ok := value.(*HashMap)
+    if !ok {
+        return "uncaught exception: " + Display(value), pos
+    }
+
+    message, ok := hash.get("message").(*String)
+    if !ok {
+        return "uncaught exception: " + Display(value), pos
+    }
+
+    line, hasLine := hash.get("line").(*Integer)
+    column, hasColumn := hash.get("column").(*Integer)
+    if hasLine && hasColumn {
+        pos = token.Position{Line: int(line.Value), Column: int(column.Value)}
+        if file, ok := hash.get("file").(*String); ok {
+            pos.File = file.Value
+        }
+    }
+
+    return message.Value, pos
+}
+
+func (hm *HashMap) set(key string, value Object) {
+    k := &String{Value: key}
+    hm.Pairs[k.HashKey()] = HashPair{Key: k, Value: value}
+}
+
+// get returns nil for a missing key
+func (hm *HashMap) get(key string) Object {
+    return hm.Pairs[(&String{Value: key}).HashKey()].Value
+}
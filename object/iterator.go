@@ -0,0 +1,110 @@
+package object
+
+import "sort"
+
+// Iterator walks over the elements of an array, the characters (runes) of a string or
+// the pairs of a hash map. Hash maps are walked in sorted key order so loops
+// behave the same on every run. The collection is copied when the iterator is
+// created, so changing it inside the loop doesn't affect the iteration.
+type Iterator struct {
+    keys []Object // indexes for arrays and strings, keys for hash maps
+    values []Object
+    byKey bool // a loop with a single variable gets the keys of a hash map
+    pos int
+}
+
+func (it *Iterator) Type() ObjectType {
+    return ITERATOR_OBJ
+}
+
+func (it *Iterator) Inspect() string {
+    return "iterator"
+}
+
+func NewIterator(obj Object) (*Iterator, bool) {
+    it := &Iterator{}
+
+    switch obj := obj.(type) {
+    case *Array:
+        for i, elem := range obj.Elements {
+            it.keys = append(it.keys, &Integer{Value: int64(i)})
+            it.values = append(it.values, elem)
+        }
+    case *String:
+        for i, ch := range []rune(obj.Value) {
+            it.keys = append(it.keys, &Integer{Value: int64(i)})
+            it.values = append(it.values, &String{Value: string(ch)})
+        }
+    case *HashMap:
+        for _, pair := range obj.SortedPairs() {
+            it.keys = append(it.keys, pair.Key)
+            it.values = append(it.values, pair.Value)
+        }
+        it.byKey = true
+    default:
+        return nil, false
+    }
+
+    return it, true
+}
+
+// Next returns the next key and value, ok is false once the iterator is exhausted
+func (it *Iterator) Next() (key Object, value Object, ok bool) {
+    if it.pos >= len(it.keys) {
+        return nil, nil, false
+    }
+
+    key, value = it.keys[it.pos], it.values[it.pos]
+    it.pos++
+
+    return key, value, true
+}
+
+// Single picks what `for (x in ...)` binds out of a key and value returned by Next
+func (it *Iterator) Single(key, value Object) Object {
+    if it.byKey {
+        return key
+    }
+    return value
+}
+
+// SortedPairs returns the pairs ordered by key: keys of the same type are compared
+// by value, keys of different types by their type name.
+func (hm *HashMap) SortedPairs() []HashPair {
+    pairs := make([]HashPair, 0, len(hm.Pairs))
+    for _, pair := range hm.Pairs {
+        pairs = append(pairs, pair)
+    }
+
+    sort.Slice(pairs, func(i, j int) bool {
+        return lessKey(pairs[i].Key, pairs[j].Key)
+    })
+
+    return pairs
+}
+
+func lessKey(a, b Object) bool {
+    if a.Type() != b.Type() {
+        // integers and floats are ordered among each other
+        x, okA := ToFloat(a)
+        y, okB := ToFloat(b)
+        if okA && okB {
+            return x < y
+        }
+
+        return a.Type() < b.Type()
+    }
+
+    switch a := a.(type) {
+    case *Integer:
+        return a.Value < b.(*Integer).Value
+    case *Float:
+        return a.Value < b.(*Float).Value
+    case *String:
+        return a.Value < b.(*String).Value
+    case *Boolean:
+        return !a.Value && b.(*Boolean).Value
+    }
+
+    return a.Inspect() < b.Inspect()
+}
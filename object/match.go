@@ -0,0 +1,73 @@
+package object
+
+import "fmt"
+
+// the evaluator and the vm both match through these, so a match picks the same arm on both
+
+// Equal is how a literal pattern compares to a value. numbers compare by value (1 matches 1.0),
+// strings and booleans too, and anything else is only equal to itself.
+func Equal(a, b Object) bool {
+    if x, ok := a.(*Integer); ok {
+        if y, ok := b.(*Integer); ok {
+            return x.Value == y.Value
+        }
+    }
+
+    if x, ok := ToFloat(a); ok {
+        y, ok := ToFloat(b)
+        return ok && x == y
+    }
+
+    switch a := a.(type) {
+    case *String:
+        b, ok := b.(*String)
+        return ok && a.Value == b.Value
+    case *Boolean:
+        b, ok := b.(*Boolean)
+        return ok && a.Value == b.Value
+    case *Null:
+        _, ok := b.(*Null)
+        return ok
+    }
+
+    return a == b
+}
+
+// MatchArray reports whether obj is an array with exactly n elements, or at least n when the
+// pattern has a ...rest
+func MatchArray(obj Object, n int, rest bool) bool {
+    arr, ok := obj.(*Array)
+    if !ok {
+        return false
+    }
+
+    if rest {
+        return len(arr.Elements) >= n
+    }
+    return len(arr.Elements) == n
+}
+
+// MatchHash reports whether obj is a hash map that has all the keys, it may have others too
+func MatchHash(obj Object, keys []Object) bool {
+    hash, ok := obj.(*HashMap)
+    if !ok {
+        return false
+    }
+
+    for _, key := range keys {
+        hashable, ok := key.(Hashable)
+        if !ok {
+            return false
+        }
+        if _, ok := hash.Pairs[hashable.HashKey()]; !ok {
+            return false
+        }
+    }
+
+    return true
+}
+
+// NoMatch is the error when none of the arms of a match fit the value
+func NoMatch(value Object) error {
+    return fmt.Errorf("no match arm for %s", value.Inspect())
+}
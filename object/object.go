@@ -3,13 +3,18 @@ package object
 import (
 	"bytes"
 	"fmt"
+	"math"
 	"monkey/ast"
+	"monkey/code"
+	"monkey/token"
+	"strconv"
 	"strings"
     "hash/fnv"
 )
 
 const (
     INTEGER_OBJ = "INTEGER"
+    FLOAT_OBJ = "FLOAT"
     STRING_OBJ  = "STRING"
     BOOLEAN_OBJ = "BOOLEAN"
     NULL_OBJ = "NULL"
@@ -20,6 +25,12 @@ const (
     ARRAY_OBJ = "ARRAY"
     HASHMAP_OBJ = "HASHMAP"
     COMPILED_FUNCTION_OBJ = "COMPILED_FUNCTION"
+    CLOSURE_OBJ = "CLOSURE"
+    BREAK_OBJ = "BREAK"
+    CONTINUE_OBJ = "CONTINUE"
+    ITERATOR_OBJ = "ITERATOR"
+    MODULE_OBJ = "MODULE"
+    CELL_OBJ = "CELL"
 )
 
 type ObjectType string
@@ -47,6 +58,45 @@ func (i *Integer) Inspect() string {
     return fmt.Sprintf("%d", i.Value)
 }
 
+type Float struct {
+    Value float64
+}
+
+func (f *Float) Type() ObjectType {
+    return FLOAT_OBJ
+}
+
+func (f *Float) Inspect() string {
+    str := strconv.FormatFloat(f.Value, 'g', -1, 64)
+
+    // keep a float looking like a float, 2.0 and not 2
+    if !strings.ContainsAny(str, ".eIN") {
+        str += ".0"
+    }
+
+    return str
+}
+
+// Display is how a value shows up inside a string: strings as they are, anything else like Inspect
+func Display(obj Object) string {
+    if str, ok := obj.(*String); ok {
+        return str.Value
+    }
+    return obj.Inspect()
+}
+
+// ToFloat returns the value of an integer or a float as a float64, ok is false for anything else
+func ToFloat(obj Object) (float64, bool) {
+    switch obj := obj.(type) {
+    case *Integer:
+        return float64(obj.Value), true
+    case *Float:
+        return obj.Value, true
+    }
+
+    return 0, false
+}
+
 type String struct {
     Value string
 }
@@ -94,8 +144,33 @@ func (rv *ReturnValue) Inspect() string {
     return rv.Value.Inspect()
 }
 
+// Break and Continue are only used by the evaluator to unwind to the enclosing loop
+type Break struct {
+}
+
+func (b *Break) Type() ObjectType {
+    return BREAK_OBJ
+}
+
+func (b *Break) Inspect() string {
+    return "break"
+}
+
+type Continue struct {
+}
+
+func (c *Continue) Type() ObjectType {
+    return CONTINUE_OBJ
+}
+
+func (c *Continue) Inspect() string {
+    return "continue"
+}
+
 type Error struct {
     Message string
+    Pos token.Position // where the error was raised, if known
+    Thrown Object // the value of a throw, nil for any other error
 }
 
 func (e *Error) Type() ObjectType {
@@ -103,13 +178,31 @@ func (e *Error) Type() ObjectType {
 }
 
 func (e *Error) Inspect() string {
+    if e.Pos.IsValid() {
+        return "ERROR: " + e.Pos.String() + ": " + e.Message
+    }
     return "ERROR: " + e.Message
 }
 
 type Function struct {
     Parameters []*ast.Identifier
+    Defaults []ast.Expression // evaluated on every call that leaves the parameter out
+    Rest *ast.Identifier // gets the extra arguments as an array, nil if there's none
     Body *ast.BlockStatement
     Env *Environment
+    Name string // the name it was bound to with let, its body can't assign to it
+}
+
+// Required is the number of parameters without a default
+func (f *Function) Required() int {
+    required := 0
+    for i := range f.Parameters {
+        if i < len(f.Defaults) && f.Defaults[i] != nil {
+            break
+        }
+        required++
+    }
+    return required
 }
 
 func (f *Function) Type() ObjectType {
@@ -120,8 +213,15 @@ func (f *Function) Inspect() string {
     var out bytes.Buffer
 
     params := []string{}
-    for _, p := range f.Parameters {
-        params = append(params, p.String())
+    for i, p := range f.Parameters {
+        if i < len(f.Defaults) && f.Defaults[i] != nil {
+            params = append(params, p.String() + " = " + f.Defaults[i].String())
+        } else {
+            params = append(params, p.String())
+        }
+    }
+    if f.Rest != nil {
+        params = append(params, "..." + f.Rest.String())
     }
 
     out.WriteString("fn")
@@ -190,6 +290,15 @@ func (i *Integer) HashKey() HashKey {
     return HashKey{Type: i.Type(), Value: uint64(i.Value)}
 }
 
+// whole floats hash like the integer they're equal to, so h[1] and h[1.0] are the same entry
+func (f *Float) HashKey() HashKey {
+    if f.Value == math.Trunc(f.Value) && math.Abs(f.Value) < 1 << 63 {
+        return HashKey{Type: INTEGER_OBJ, Value: uint64(int64(f.Value))}
+    }
+
+    return HashKey{Type: f.Type(), Value: math.Float64bits(f.Value)}
+}
+
 func (s *String) HashKey() HashKey {
     h := fnv.New64a()
     h.Write([]byte(s.Value))
@@ -226,10 +335,43 @@ func (hm *HashMap) Inspect() string {
     return out.String()
 }
 
+// Module is the namespace an import gives back, holding what the file exported
+type Module struct {
+    Path string
+    Exports map[string]Object
+}
+
+func (m *Module) Type() ObjectType {
+    return MODULE_OBJ
+}
+
+func (m *Module) Inspect() string {
+    return "module(" + m.Path + ")"
+}
+
+// Member is m.name or m["name"], both engines index modules through it
+func (m *Module) Member(name Object) (Object, error) {
+    str, ok := name.(*String)
+    if !ok {
+        return nil, fmt.Errorf("module index must be STRING, got %s", name.Type())
+    }
+
+    value, ok := m.Exports[str.Value]
+    if !ok {
+        return nil, fmt.Errorf("module %s has no export %q", m.Path, str.Value)
+    }
+
+    return value, nil
+}
+
 type CompiledFunction struct {
     Instructions []byte
     NumLocals int
-    NumParams int
+    NumParams int // not counting a ...rest parameter
+    NumDefaults int // the last NumDefaults parameters have a default value
+    Variadic bool // there's a ...rest parameter, stored in the local right after the others
+    Name string // empty for anonymous functions
+    Positions code.PosTable
 }
 
 func (cf *CompiledFunction) Type() ObjectType {
@@ -239,3 +381,44 @@ func (cf *CompiledFunction) Type() ObjectType {
 func (cf *CompiledFunction) Inspect() string {
     return fmt.Sprintf("CompiledFunction[%p]", cf)
 }
+
+// CheckArity is the argument count check both engines do before calling a function
+func CheckArity(required, params int, variadic bool, got int) error {
+    switch {
+    case got >= required && (variadic || got <= params):
+        return nil
+    case variadic:
+        return fmt.Errorf("wrong number of arguments: want=at least %d, got=%d", required, got)
+    case required == params:
+        return fmt.Errorf("wrong number of arguments: want=%d, got=%d", params, got)
+    default:
+        return fmt.Errorf("wrong number of arguments: want=%d to %d, got=%d", required, params, got)
+    }
+}
+
+type Closure struct {
+    Fn *CompiledFunction
+    Free []Object // cells of the free variables captured when the closure was created
+}
+
+func (c *Closure) Type() ObjectType {
+    return CLOSURE_OBJ
+}
+
+func (c *Closure) Inspect() string {
+    return fmt.Sprintf("Closure[%p]", c)
+}
+
+// Cell holds a local of the vm once a closure captures it, so the function and its closures
+// share the variable and see each other's assignments. it never shows up as a value.
+type Cell struct {
+    Value Object
+}
+
+func (c *Cell) Type() ObjectType {
+    return CELL_OBJ
+}
+
+func (c *Cell) Inspect() string {
+    return c.Value.Inspect()
+}
@@ -1,6 +1,7 @@
 package object
 
 import (
+    "math"
     "testing"
 )
 
@@ -22,3 +23,36 @@ func TestStringHashKey(t *testing.T) {
         t.Errorf("strings with different content have same hash keys")
     }
 }
+
+func TestFloatHashKey(t *testing.T) {
+    if (&Float{Value: 1.5}).HashKey() != (&Float{Value: 1.5}).HashKey() {
+        t.Errorf("floats with same value have different hash keys")
+    }
+
+    if (&Float{Value: 1.5}).HashKey() == (&Float{Value: 2.5}).HashKey() {
+        t.Errorf("floats with different values have same hash keys")
+    }
+
+    if (&Float{Value: 2}).HashKey() != (&Integer{Value: 2}).HashKey() {
+        t.Errorf("whole float and equal integer have different hash keys")
+    }
+}
+
+func TestFloatInspect(t *testing.T) {
+    tests := []struct {
+        value float64
+        expected string
+    }{
+        {2, "2.0"},
+        {-0.5, "-0.5"},
+        {1e21, "1e+21"},
+        {math.Inf(1), "+Inf"},
+    }
+
+    for _, tt := range tests {
+        got := (&Float{Value: tt.value}).Inspect()
+        if got != tt.expected {
+            t.Errorf("wrong Inspect for %g. want=%q, got=%q", tt.value, tt.expected, got)
+        }
+    }
+}
@@ -6,32 +6,49 @@ import (
 	"monkey/lexer"
 	"monkey/token"
 	"strconv"
+	"unicode/utf8"
 )
 
 // basically an enum
 const (
     _ int = iota
     LOWEST
+    ASSIGN      // =
+    LOGICAL_OR  // ||
+    LOGICAL_AND // &&
     EQUALS      // ==
     LESSGREATER // > or <
-    SUM         // +
-    PRODUCT     // *
+    SUM         // + - | ^
+    PRODUCT     // * / % & << >>
     PREFIX      // -X or !X
     CALL        // myFunction(X)
     INDEX       // array[index]
 )
 
 var precedences = map[token.TokenType]int {
+    token.ASSIGN: ASSIGN,
+    token.OR: LOGICAL_OR,
+    token.AND: LOGICAL_AND,
     token.EQ: EQUALS,
     token.NOT_EQ: EQUALS,
     token.LT: LESSGREATER,
     token.GT: LESSGREATER,
+    token.LT_EQ: LESSGREATER,
+    token.GT_EQ: LESSGREATER,
+    // bitwise operators bind like in Go, so x & 1 == 0 means (x & 1) == 0
     token.PLUS: SUM,
     token.MINUS: SUM,
+    token.PIPE: SUM,
+    token.CARET: SUM,
     token.ASTERISK: PRODUCT,
     token.SLASH: PRODUCT,
+    token.PERCENT: PRODUCT,
+    token.AMPERSAND: PRODUCT,
+    token.SHL: PRODUCT,
+    token.SHR: PRODUCT,
     token.LPAREN: CALL,
     token.LBRACKET: INDEX,
+    token.DOT: INDEX,
 }
 
 type (
@@ -46,6 +63,9 @@ type Parser struct {
     peekToken token.Token
     errors []string
 
+    loopDepth int // how many loops enclose the current statement within the current function
+    lastIllegal token.Position // the ILLEGAL token reported last, it can be run into again after the error
+
     prefixParseFuncs map[token.TokenType]prefixParseFunc
     infixParseFuncs map[token.TokenType]infixParseFunc
 }
@@ -58,14 +78,19 @@ func NewParser(lex *lexer.Lexer) *Parser {
     p.prefixParseFuncs = make(map[token.TokenType]prefixParseFunc)
     p.registerPrefix(token.IDENT, p.parseIdentifier)
     p.registerPrefix(token.INT, p.parseIntegerLiteral)
+    p.registerPrefix(token.FLOAT, p.parseFloatLiteral)
     p.registerPrefix(token.BANG, p.parsePrefixExpression)
     p.registerPrefix(token.MINUS, p.parsePrefixExpression)
+    p.registerPrefix(token.TILDE, p.parsePrefixExpression)
     p.registerPrefix(token.FALSE, p.parseBoolean)
     p.registerPrefix(token.TRUE, p.parseBoolean)
     p.registerPrefix(token.LPAREN, p.parseGroupedExpression)
     p.registerPrefix(token.IF, p.parseIfExpression)
+    p.registerPrefix(token.MATCH, p.parseMatchExpression)
     p.registerPrefix(token.FUNCTION, p.parseFunctionLiteral)
+    p.registerPrefix(token.IMPORT, p.parseImportExpression)
     p.registerPrefix(token.STRING, p.parseStringLiteral)
+    p.registerPrefix(token.INTERP_START, p.parseInterpolatedString)
     p.registerPrefix(token.LBRACKET, p.parseArrayLiteral)
     p.registerPrefix(token.LBRACE, p.parseHashLiteral)
 
@@ -76,10 +101,22 @@ func NewParser(lex *lexer.Lexer) *Parser {
     p.registerInfix(token.ASTERISK, p.parseInfixExpression)
     p.registerInfix(token.EQ, p.parseInfixExpression)
     p.registerInfix(token.NOT_EQ, p.parseInfixExpression)
+    p.registerInfix(token.ASSIGN, p.parseAssignExpression)
+    p.registerInfix(token.AND, p.parseInfixExpression)
+    p.registerInfix(token.OR, p.parseInfixExpression)
+    p.registerInfix(token.LT_EQ, p.parseInfixExpression)
+    p.registerInfix(token.GT_EQ, p.parseInfixExpression)
+    p.registerInfix(token.PERCENT, p.parseInfixExpression)
+    p.registerInfix(token.AMPERSAND, p.parseInfixExpression)
+    p.registerInfix(token.PIPE, p.parseInfixExpression)
+    p.registerInfix(token.CARET, p.parseInfixExpression)
+    p.registerInfix(token.SHL, p.parseInfixExpression)
+    p.registerInfix(token.SHR, p.parseInfixExpression)
     p.registerInfix(token.LT, p.parseInfixExpression)
     p.registerInfix(token.GT, p.parseInfixExpression)
     p.registerInfix(token.LPAREN, p.parseCallExpression)
     p.registerInfix(token.LBRACKET, p.parseIndexExpression)
+    p.registerInfix(token.DOT, p.parseMemberExpression)
 
     return p
 }
@@ -89,7 +126,12 @@ func (p *Parser) ParseProgram() *ast.Program {
     program.Statements = make([]ast.Statement, 0)
 
     for !p.curTokenIs(token.EOF) {
-        stmt := p.parseStatement()
+        var stmt ast.Statement
+        if p.curTokenIs(token.EXPORT) {
+            stmt = p.parseExportStatement()
+        } else {
+            stmt = p.parseStatement()
+        }
         if stmt != nil {
             program.Statements = append(program.Statements, stmt)
         }
@@ -106,19 +148,60 @@ func (p *Parser) parseStatement() ast.Statement {
         return p.parseLetStatement()
     case token.RETURN:
         return p.parseReturnStatement()
+    case token.WHILE:
+        return p.parseWhileStatement()
+    case token.FOR:
+        return p.parseForStatement()
+    case token.BREAK:
+        return p.parseBreakStatement()
+    case token.CONTINUE:
+        return p.parseContinueStatement()
+    case token.TRY:
+        return p.parseTryStatement()
+    case token.THROW:
+        return p.parseThrowStatement()
+    case token.EXPORT: // ParseProgram handles the ones at the top level
+        p.errorAt(p.curToken.Pos, "export is only allowed at the top level")
+        return nil
     default:
         return p.parseExpressionStatement()
     }
 }
 
+// export let ...
+func (p *Parser) parseExportStatement() ast.Statement {
+    if !p.expectPeek(token.LET) {
+        return nil
+    }
+
+    stmt := p.parseLetStatement()
+    if stmt == nil {
+        return nil
+    }
+    stmt.Exported = true
+
+    return stmt
+}
+
 func (p *Parser) parseLetStatement() *ast.LetStatement {
     stmt := &ast.LetStatement{Token: p.curToken}
 
-    if !p.expectPeek(token.IDENT) {
+    switch {
+    case p.peekTokenIs(token.LBRACKET):
+        p.nextToken()
+        stmt.Pattern = p.parseArrayPattern()
+    case p.peekTokenIs(token.LBRACE):
+        p.nextToken()
+        stmt.Pattern = p.parseHashPattern()
+    case p.expectPeek(token.IDENT):
+        stmt.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+    default:
         return nil
     }
 
-    stmt.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+    if stmt.Name == nil && stmt.Pattern == nil {
+        return nil
+    }
 
     if !p.expectPeek(token.ASSIGN) {
         return nil
@@ -128,6 +211,10 @@ func (p *Parser) parseLetStatement() *ast.LetStatement {
 
     stmt.Value = p.parseExpression(LOWEST)
 
+    if funcLit, ok := stmt.Value.(*ast.FunctionLiteral); ok && stmt.Name != nil {
+        funcLit.Name = stmt.Name.Value
+    }
+
     // Optional semicolons
     if p.peekTokenIs(token.SEMICOLON) {
         p.nextToken()
@@ -136,6 +223,57 @@ func (p *Parser) parseLetStatement() *ast.LetStatement {
     return stmt
 }
 
+// [a, b, ...rest], the ...rest is optional and has to come last
+func (p *Parser) parseArrayPattern() ast.Pattern {
+    pattern := &ast.ArrayPattern{Token: p.curToken}
+
+    for !p.peekTokenIs(token.RBRACKET) {
+        if pattern.Rest != nil {
+            p.errorAt(p.peekToken.Pos, "...%s must be the last element of the pattern", pattern.Rest.Value)
+            return nil
+        }
+
+        if p.peekTokenIs(token.ELLIPSIS) {
+            p.nextToken()
+            if !p.expectPeek(token.IDENT) {
+                return nil
+            }
+            pattern.Rest = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+        } else {
+            if !p.expectPeek(token.IDENT) {
+                return nil
+            }
+            pattern.Elements = append(pattern.Elements, &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal})
+        }
+
+        if !p.peekTokenIs(token.RBRACKET) && !p.expectPeek(token.COMMA) {
+            return nil
+        }
+    }
+    p.nextToken()
+
+    return pattern
+}
+
+// {name, age}
+func (p *Parser) parseHashPattern() ast.Pattern {
+    pattern := &ast.HashPattern{Token: p.curToken}
+
+    for !p.peekTokenIs(token.RBRACE) {
+        if !p.expectPeek(token.IDENT) {
+            return nil
+        }
+        pattern.Keys = append(pattern.Keys, &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal})
+
+        if !p.peekTokenIs(token.RBRACE) && !p.expectPeek(token.COMMA) {
+            return nil
+        }
+    }
+    p.nextToken()
+
+    return pattern
+}
+
 func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
     stmt := &ast.ReturnStatement{Token: p.curToken}
 
@@ -150,6 +288,169 @@ func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
     return stmt
 }
 
+func (p *Parser) parseWhileStatement() ast.Statement {
+    stmt := &ast.WhileStatement{Token: p.curToken}
+
+    if !p.expectPeek(token.LPAREN) {
+        return nil
+    }
+    p.nextToken()
+
+    stmt.Condition = p.parseExpression(LOWEST)
+
+    if !p.expectPeek(token.RPAREN) {
+        return nil
+    }
+
+    if !p.expectPeek(token.LBRACE) {
+        return nil
+    }
+
+    p.loopDepth++
+    stmt.Body = p.parseBlockStatement()
+    p.loopDepth--
+
+    if p.peekTokenIs(token.SEMICOLON) {
+        p.nextToken()
+    }
+
+    return stmt
+}
+
+func (p *Parser) parseForStatement() ast.Statement {
+    stmt := &ast.ForStatement{Token: p.curToken}
+
+    if !p.expectPeek(token.LPAREN) {
+        return nil
+    }
+
+    if !p.expectPeek(token.IDENT) {
+        return nil
+    }
+    stmt.Value = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+    if p.peekTokenIs(token.COMMA) { // for (k, v in ...)
+        p.nextToken()
+
+        if !p.expectPeek(token.IDENT) {
+            return nil
+        }
+        stmt.Key = stmt.Value
+        stmt.Value = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+    }
+
+    if !p.expectPeek(token.IN) {
+        return nil
+    }
+    p.nextToken()
+
+    stmt.Iterable = p.parseExpression(LOWEST)
+
+    if !p.expectPeek(token.RPAREN) {
+        return nil
+    }
+
+    if !p.expectPeek(token.LBRACE) {
+        return nil
+    }
+
+    p.loopDepth++
+    stmt.Body = p.parseBlockStatement()
+    p.loopDepth--
+
+    if p.peekTokenIs(token.SEMICOLON) {
+        p.nextToken()
+    }
+
+    return stmt
+}
+
+// try { } catch (e) { } finally { }, one of catch and finally can be left out
+func (p *Parser) parseTryStatement() ast.Statement {
+    stmt := &ast.TryStatement{Token: p.curToken}
+
+    if !p.expectPeek(token.LBRACE) {
+        return nil
+    }
+    stmt.Body = p.parseBlockStatement()
+
+    if p.peekTokenIs(token.CATCH) {
+        p.nextToken()
+
+        if !p.expectPeek(token.LPAREN) || !p.expectPeek(token.IDENT) {
+            return nil
+        }
+        stmt.CatchParam = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+        if !p.expectPeek(token.RPAREN) || !p.expectPeek(token.LBRACE) {
+            return nil
+        }
+        stmt.Catch = p.parseBlockStatement()
+    }
+
+    if p.peekTokenIs(token.FINALLY) {
+        p.nextToken()
+
+        if !p.expectPeek(token.LBRACE) {
+            return nil
+        }
+        stmt.Finally = p.parseBlockStatement()
+    }
+
+    if stmt.Catch == nil && stmt.Finally == nil {
+        p.errorAt(p.peekToken.Pos, "expected catch or finally after the try block, got {%s} instead", p.peekToken.Type)
+        return nil
+    }
+
+    if p.peekTokenIs(token.SEMICOLON) {
+        p.nextToken()
+    }
+
+    return stmt
+}
+
+func (p *Parser) parseThrowStatement() ast.Statement {
+    stmt := &ast.ThrowStatement{Token: p.curToken}
+
+    p.nextToken()
+
+    stmt.Value = p.parseExpression(LOWEST)
+
+    if p.peekTokenIs(token.SEMICOLON) {
+        p.nextToken()
+    }
+
+    return stmt
+}
+
+func (p *Parser) parseBreakStatement() ast.Statement {
+    stmt := &ast.BreakStatement{Token: p.curToken}
+
+    if p.loopDepth == 0 {
+        p.errorAt(p.curToken.Pos, "break outside of a loop")
+    }
+
+    if p.peekTokenIs(token.SEMICOLON) {
+        p.nextToken()
+    }
+
+    return stmt
+}
+
+func (p *Parser) parseContinueStatement() ast.Statement {
+    stmt := &ast.ContinueStatement{Token: p.curToken}
+
+    if p.loopDepth == 0 {
+        p.errorAt(p.curToken.Pos, "continue outside of a loop")
+    }
+
+    if p.peekTokenIs(token.SEMICOLON) {
+        p.nextToken()
+    }
+
+    return stmt
+}
+
 func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
     stmt := &ast.ExpressionStatement{Token: p.curToken}
 
@@ -194,8 +495,21 @@ func (p *Parser) parseIntegerLiteral() ast.Expression {
 
     value, err := strconv.ParseInt(p.curToken.Literal, 0, 64)
     if err != nil {
-        message := fmt.Sprintf("could not parse %q as integer", p.curToken.Literal)
-        p.errors = append(p.errors, message)
+        p.errorAt(p.curToken.Pos, "could not parse %q as integer", p.curToken.Literal)
+        return nil
+    }
+
+    literal.Value = value
+
+    return literal
+}
+
+func (p *Parser) parseFloatLiteral() ast.Expression {
+    literal := &ast.FloatLiteral{Token: p.curToken}
+
+    value, err := strconv.ParseFloat(p.curToken.Literal, 64)
+    if err != nil {
+        p.errorAt(p.curToken.Pos, "could not parse %q as float", p.curToken.Literal)
         return nil
     }
 
@@ -210,6 +524,39 @@ func (p *Parser) parseStringLiteral() ast.Expression {
     return literal
 }
 
+func (p *Parser) parseInterpolatedString() ast.Expression {
+    str := &ast.InterpolatedString{Token: p.curToken}
+
+    for {
+        // the empty text between two ${} doesn't need to be kept
+        if p.curToken.Literal != "" {
+            str.Parts = append(str.Parts, &ast.StringLiteral{Token: p.curToken, Value: p.curToken.Literal})
+        }
+
+        if p.curTokenIs(token.INTERP_END) {
+            return str
+        }
+
+        p.nextToken()
+        if p.curTokenIs(token.INTERP_MID) || p.curTokenIs(token.INTERP_END) {
+            p.errorAt(p.curToken.Pos, "empty ${} in string")
+            return nil
+        }
+        str.Parts = append(str.Parts, p.parseExpression(LOWEST))
+
+        if p.peekTokenIs(token.ILLEGAL) {
+            p.illegalTokenError(p.peekToken)
+            return nil
+        }
+
+        if !p.peekTokenIs(token.INTERP_MID) && !p.peekTokenIs(token.INTERP_END) {
+            p.errorAt(p.peekToken.Pos, "expected } to close the ${ in a string, got {%s} instead", p.peekToken.Type)
+            return nil
+        }
+        p.nextToken()
+    }
+}
+
 func (p *Parser) parsePrefixExpression() ast.Expression {
     expression := &ast.PrefixExpression{
         Token: p.curToken,
@@ -240,6 +587,26 @@ func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
     return expression
 }
 
+func (p *Parser) parseAssignExpression(target ast.Expression) ast.Expression {
+    switch target.(type) {
+    case *ast.Identifier, *ast.IndexExpression:
+    case nil: // the target didn't parse, that's already been reported
+        return nil
+    default:
+        p.errorAt(p.curToken.Pos, "cannot assign to %s", target.String())
+        return nil
+    }
+
+    expression := &ast.AssignExpression{Token: p.curToken, Target: target}
+
+    p.nextToken()
+
+    // parsed with the lowest precedence so a = b = c assigns right to left
+    expression.Value = p.parseExpression(LOWEST)
+
+    return expression
+}
+
 func (p *Parser) parseGroupedExpression() ast.Expression {
     p.nextToken()
 
@@ -317,13 +684,177 @@ func (p *Parser) parseIfExpression() ast.Expression {
     return expression
 }
 
+// match (subject) { pattern => value, pattern if guard => value }, the last comma is optional
+func (p *Parser) parseMatchExpression() ast.Expression {
+    expression := &ast.MatchExpression{Token: p.curToken}
+
+    if !p.expectPeek(token.LPAREN) {
+        return nil
+    }
+    p.nextToken()
+
+    expression.Subject = p.parseExpression(LOWEST)
+
+    if !p.expectPeek(token.RPAREN) || !p.expectPeek(token.LBRACE) {
+        return nil
+    }
+
+    for !p.peekTokenIs(token.RBRACE) {
+        p.nextToken()
+
+        arm := &ast.MatchArm{Pattern: p.parseMatchPattern()}
+        if arm.Pattern == nil {
+            return nil
+        }
+
+        if p.peekTokenIs(token.IF) {
+            p.nextToken()
+            p.nextToken()
+
+            arm.Guard = p.parseExpression(LOWEST)
+            if arm.Guard == nil {
+                return nil
+            }
+        }
+
+        if !p.expectPeek(token.ARROW) {
+            return nil
+        }
+        p.nextToken()
+
+        arm.Value = p.parseExpression(LOWEST)
+        if arm.Value == nil {
+            return nil
+        }
+        expression.Arms = append(expression.Arms, arm)
+
+        if !p.peekTokenIs(token.RBRACE) && !p.expectPeek(token.COMMA) {
+            return nil
+        }
+    }
+    p.nextToken()
+
+    return expression
+}
+
+func (p *Parser) parseMatchPattern() ast.MatchPattern {
+    switch p.curToken.Type {
+    case token.IDENT:
+        if p.curToken.Literal == "_" {
+            return &ast.WildcardPattern{Token: p.curToken}
+        }
+        return &ast.BindingPattern{Name: &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}}
+    case token.INT, token.FLOAT, token.STRING, token.TRUE, token.FALSE, token.MINUS:
+        return p.parseLiteralPattern()
+    case token.LBRACKET:
+        return p.parseArrayMatchPattern()
+    case token.LBRACE:
+        return p.parseHashMatchPattern()
+    }
+
+    p.errorAt(p.curToken.Pos, "expected a pattern, got {%s} instead", p.curToken.Type)
+    return nil
+}
+
+// 1, -2.5, "a", true. the minus is only allowed in front of a number
+func (p *Parser) parseLiteralPattern() ast.MatchPattern {
+    pattern := &ast.LiteralPattern{Token: p.curToken}
+
+    if p.curTokenIs(token.MINUS) && !p.peekTokenIs(token.INT) && !p.peekTokenIs(token.FLOAT) {
+        p.errorAt(p.peekToken.Pos, "expected a number after - in a pattern, got {%s} instead", p.peekToken.Type)
+        return nil
+    }
+
+    pattern.Value = p.prefixParseFuncs[p.curToken.Type]()
+    if pattern.Value == nil {
+        return nil
+    }
+
+    return pattern
+}
+
+// [p1, p2, ...rest]
+func (p *Parser) parseArrayMatchPattern() ast.MatchPattern {
+    pattern := &ast.ArrayMatchPattern{Token: p.curToken}
+
+    for !p.peekTokenIs(token.RBRACKET) {
+        if pattern.Rest != nil {
+            p.errorAt(p.peekToken.Pos, "...%s must be the last element of the pattern", pattern.Rest.Value)
+            return nil
+        }
+        p.nextToken()
+
+        if p.curTokenIs(token.ELLIPSIS) {
+            if !p.expectPeek(token.IDENT) {
+                return nil
+            }
+            pattern.Rest = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+        } else {
+            element := p.parseMatchPattern()
+            if element == nil {
+                return nil
+            }
+            pattern.Elements = append(pattern.Elements, element)
+        }
+
+        if !p.peekTokenIs(token.RBRACKET) && !p.expectPeek(token.COMMA) {
+            return nil
+        }
+    }
+    p.nextToken()
+
+    return pattern
+}
+
+// {"key": pattern, 1: pattern, name}
+func (p *Parser) parseHashMatchPattern() ast.MatchPattern {
+    pattern := &ast.HashMatchPattern{Token: p.curToken}
+
+    for !p.peekTokenIs(token.RBRACE) {
+        p.nextToken()
+
+        var key ast.Expression
+        var value ast.MatchPattern
+
+        switch p.curToken.Type {
+        case token.IDENT:
+            key = &ast.StringLiteral{Token: p.curToken, Value: p.curToken.Literal}
+            value = p.parseMatchPattern()
+        case token.STRING, token.INT, token.TRUE, token.FALSE:
+            key = p.prefixParseFuncs[p.curToken.Type]()
+            if key == nil || !p.expectPeek(token.COLON) {
+                return nil
+            }
+            p.nextToken()
+
+            value = p.parseMatchPattern()
+            if value == nil {
+                return nil
+            }
+        default:
+            p.errorAt(p.curToken.Pos, "expected a string, integer or boolean key in the pattern, got {%s} instead", p.curToken.Type)
+            return nil
+        }
+
+        pattern.Keys = append(pattern.Keys, key)
+        pattern.Values = append(pattern.Values, value)
+
+        if !p.peekTokenIs(token.RBRACE) && !p.expectPeek(token.COMMA) {
+            return nil
+        }
+    }
+    p.nextToken()
+
+    return pattern
+}
+
 func (p *Parser) parseBlockStatement() *ast.BlockStatement {
     block := &ast.BlockStatement{Token: p.curToken}
     block.Statements = make([]ast.Statement, 0)
 
     p.nextToken()
 
-    for !p.curTokenIs(token.RBRACE) {
+    for !p.curTokenIs(token.RBRACE) && !p.curTokenIs(token.EOF) {
         stmt := p.parseStatement()
         if stmt != nil {
             block.Statements = append(block.Statements, stmt)
@@ -331,6 +862,11 @@ func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 
         p.nextToken()
     }
+
+    if !p.curTokenIs(token.RBRACE) {
+        p.errorAt(p.curToken.Pos, "expected {%s} to close the block, got {%s} instead", token.RBRACE, p.curToken.Type)
+    }
+
     return block
 }
 
@@ -341,43 +877,66 @@ func (p *Parser) parseFunctionLiteral() ast.Expression {
         return nil
     }
 
-    funcLit.Parameters = p.parseFunctionParameters()
+    if !p.parseFunctionParameters(funcLit) {
+        return nil
+    }
 
     if !p.expectPeek(token.LBRACE) {
         return nil
     }
 
+    // loops outside of the function can't be broken out of from inside it
+    outerLoopDepth := p.loopDepth
+    p.loopDepth = 0
     funcLit.Body = p.parseBlockStatement()
+    p.loopDepth = outerLoopDepth
 
     return funcLit
 }
 
-func (p *Parser) parseFunctionParameters() []*ast.Identifier {
-    idents := make([]*ast.Identifier, 0)
-
-    if p.peekTokenIs(token.RPAREN) {
-        p.nextToken()
-        return idents
-    }
-
-    p.nextToken() // we were on LPAREN, now we are on IDENT
+// fn(a, b = 10, ...rest), parameters with a default come after the ones without and ...rest comes last
+func (p *Parser) parseFunctionParameters(funcLit *ast.FunctionLiteral) bool {
+    funcLit.Parameters = make([]*ast.Identifier, 0)
 
-    ident := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
-    idents = append(idents, ident)
+    for !p.peekTokenIs(token.RPAREN) {
+        if funcLit.Rest != nil {
+            p.errorAt(p.peekToken.Pos, "...%s must be the last parameter", funcLit.Rest.Value)
+            return false
+        }
 
-    for p.peekTokenIs(token.COMMA) {
-        p.nextToken()
-        p.nextToken() // we do it twice because we want to skip the previous ident and comma
+        if p.peekTokenIs(token.ELLIPSIS) {
+            p.nextToken()
+            if !p.expectPeek(token.IDENT) {
+                return false
+            }
+            funcLit.Rest = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+        } else {
+            if !p.expectPeek(token.IDENT) {
+                return false
+            }
+            ident := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+            var defaultValue ast.Expression
+            if p.peekTokenIs(token.ASSIGN) {
+                p.nextToken()
+                p.nextToken()
+                defaultValue = p.parseExpression(LOWEST)
+            } else if funcLit.HasDefaults() {
+                p.errorAt(ident.Pos(), "parameter %s needs a default value, it follows one that has one", ident.Value)
+                return false
+            }
 
-        ident := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
-        idents = append(idents, ident)
-    }
+            funcLit.Parameters = append(funcLit.Parameters, ident)
+            funcLit.Defaults = append(funcLit.Defaults, defaultValue)
+        }
 
-    if !p.expectPeek(token.RPAREN) {
-        return nil
+        if !p.peekTokenIs(token.RPAREN) && !p.expectPeek(token.COMMA) {
+            return false
+        }
     }
+    p.nextToken()
 
-    return idents
+    return true
 }
 
 func (p *Parser) parseCallExpression(function ast.Expression) ast.Expression {
@@ -408,6 +967,30 @@ func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
     return expression
 }
 
+// m.name is m["name"]
+func (p *Parser) parseMemberExpression(left ast.Expression) ast.Expression {
+    expression := &ast.IndexExpression{Token: p.curToken, Left: left}
+
+    if !p.expectPeek(token.IDENT) {
+        return nil
+    }
+    expression.Index = &ast.StringLiteral{Token: p.curToken, Value: p.curToken.Literal}
+
+    return expression
+}
+
+// import "path/to/file.monkey"
+func (p *Parser) parseImportExpression() ast.Expression {
+    expression := &ast.ImportExpression{Token: p.curToken}
+
+    if !p.expectPeek(token.STRING) {
+        return nil
+    }
+    expression.Path = p.curToken.Literal
+
+    return expression
+}
+
 func (p *Parser) parseExpressionList(end token.TokenType) []ast.Expression {
     list := make([]ast.Expression, 0)
 
@@ -515,14 +1098,39 @@ func (p *Parser) Errors() []string {
     return p.errors
 }
 
-func (p *Parser) peekError(t token.TokenType) {
-    message := fmt.Sprintf("expected next token to be {%s}, got {%s} instead", t, p.peekToken.Type)
+// every parser error is reported as "file:line:col: message"
+func (p *Parser) errorAt(pos token.Position, format string, a ...interface{}) {
+    message := fmt.Sprintf("%s: %s", pos, fmt.Sprintf(format, a...))
     p.errors = append(p.errors, message)
 }
 
+func (p *Parser) peekError(t token.TokenType) {
+    if p.peekTokenIs(token.ILLEGAL) {
+        p.illegalTokenError(p.peekToken)
+        return
+    }
+    p.errorAt(p.peekToken.Pos, "expected next token to be {%s}, got {%s} instead", t, p.peekToken.Type)
+}
+
 func (p *Parser) noPrefixFuncError(t token.TokenType) {
-    message := fmt.Sprintf("no prefix parse function for {%s} found", t)
-    p.errors = append(p.errors, message)
+    if t == token.ILLEGAL {
+        p.illegalTokenError(p.curToken)
+        return
+    }
+    p.errorAt(p.curToken.Pos, "no prefix parse function for {%s} found", t)
+}
+
+func (p *Parser) illegalTokenError(tok token.Token) {
+    if tok.Pos == p.lastIllegal {
+        return
+    }
+    p.lastIllegal = tok.Pos
+
+    if utf8.RuneCountInString(tok.Literal) == 1 {
+        p.errorAt(tok.Pos, "illegal character %q", tok.Literal)
+        return
+    }
+    p.errorAt(tok.Pos, "%s", tok.Literal) // the lexer already described the problem
 }
 
 func (p *Parser) registerPrefix(tokenType token.TokenType, fn prefixParseFunc) {
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"monkey/ast"
 	"monkey/lexer"
+	"strings"
 	"testing"
 )
 
@@ -41,6 +42,73 @@ func TestLetStatements(t *testing.T) {
     }
 }
 
+func TestDestructuringLetStatements(t *testing.T) {
+    tests := []struct {
+        input string
+        expected string
+    }{
+        {"let [a, b] = xs;", "let [a, b] = xs;"},
+        {"let [first, ...rest] = f();", "let [first, ...rest] = f();"},
+        {"let [...all] = xs", "let [...all] = xs;"},
+        {"let [] = xs", "let [] = xs;"},
+        {"let {name, age} = person;", "let {name, age} = person;"},
+        {"let {} = h", "let {} = h;"},
+    }
+
+    for _, tt := range tests {
+        lex := lexer.NewLexer(tt.input)
+        p := NewParser(lex)
+        program := p.ParseProgram()
+        checkParserErrors(t, p)
+
+        if len(program.Statements) != 1 {
+            t.Fatalf("program.Statements does not contain 1 statements. got=%d", len(program.Statements))
+        }
+
+        stmt, ok := program.Statements[0].(*ast.LetStatement)
+        if !ok {
+            t.Fatalf("stmt is not *ast.LetStatement. got=%T", program.Statements[0])
+        }
+
+        if stmt.Name != nil || stmt.Pattern == nil {
+            t.Fatalf("expected a pattern and no name. got name=%v, pattern=%v", stmt.Name, stmt.Pattern)
+        }
+
+        if stmt.String() != tt.expected {
+            t.Errorf("expected=%q, got=%q", tt.expected, stmt.String())
+        }
+    }
+}
+
+func TestDestructuringPatternErrors(t *testing.T) {
+    tests := []struct {
+        input string
+        expectedError string
+    }{
+        {"let [...rest, a] = xs;", "1:15: ...rest must be the last element of the pattern"},
+        {"let [a b] = xs;", "1:8: expected next token to be {,}, got {IDENT} instead"},
+        {"let [1] = xs;", "1:6: expected next token to be {IDENT}, got {INT} instead"},
+        {"let {a: b} = h;", "1:7: expected next token to be {,}, got {:} instead"},
+        {"let [a] xs;", "1:9: expected next token to be {=}, got {IDENT} instead"},
+    }
+
+    for _, tt := range tests {
+        l := lexer.NewLexer(tt.input)
+        p := NewParser(l)
+        p.ParseProgram()
+
+        errors := p.Errors()
+        if len(errors) == 0 {
+            t.Errorf("expected parser errors for %q, got none", tt.input)
+            continue
+        }
+
+        if errors[0] != tt.expectedError {
+            t.Errorf("wrong error for %q. expected=%q, got=%q", tt.input, tt.expectedError, errors[0])
+        }
+    }
+}
+
 func testLetStatement(t *testing.T, s ast.Statement, name string) bool {
     if s.TokenLiteral() != "let" {
         t.Errorf("s.TokenLiteral not 'let'. got=%q", s.TokenLiteral())
@@ -111,6 +179,57 @@ func checkParserErrors(t *testing.T, p *Parser) {
     t.FailNow()
 }
 
+func TestParserErrorPositions(t *testing.T) {
+    tests := []struct {
+        input string
+        expectedError string
+    }{
+        {"let = 5;", "1:5: expected next token to be {IDENT}, got {=} instead"},
+        {"let x 5;", "1:7: expected next token to be {=}, got {INT} instead"},
+        {"let x = 5;\nlet y = ;", "2:9: no prefix parse function for {;} found"},
+        {"1 +\n  99999999999999999999", "2:3: could not parse \"99999999999999999999\" as integer"},
+        {"let x = 1 + /* oops", "1:13: unterminated block comment"},
+        {"let x #", "1:7: illegal character \"#\""},
+        {"# // nothing else", "1:1: illegal character \"#\""},
+        {"let قیمت = 5 €", "1:14: illegal character \"€\""},
+        {"let s = \"abc;\nlet t = 1;", "1:9: unterminated string literal"},
+        {"puts(\"a\\qb\")", "1:6: invalid escape sequence \\q in string literal"},
+        {"let s = `abc", "1:9: unterminated raw string literal"},
+        {`"a ${}"`, "1:6: empty ${} in string"},
+        {`"a ${b c}"`, "1:8: expected } to close the ${ in a string, got {IDENT} instead"},
+        {`"a ${b} \q"`, "1:7: invalid escape sequence \\q in string literal"},
+    }
+
+    for _, tt := range tests {
+        l := lexer.NewLexer(tt.input)
+        p := NewParser(l)
+        p.ParseProgram()
+
+        errors := p.Errors()
+        if len(errors) == 0 {
+            t.Errorf("expected parser errors for %q, got none", tt.input)
+            continue
+        }
+
+        if errors[0] != tt.expectedError {
+            t.Errorf("wrong parser error. want=%q, got=%q", tt.expectedError, errors[0])
+        }
+    }
+}
+
+func TestIllegalTokenReportedOnce(t *testing.T) {
+    tests := []string{`"${1"`, `"a ${b`, "let x = 1 + /* oops"}
+
+    for _, input := range tests {
+        p := NewParser(lexer.NewLexer(input))
+        p.ParseProgram()
+
+        if len(p.Errors()) != 1 {
+            t.Errorf("expected one parser error for %q, got %q", input, p.Errors())
+        }
+    }
+}
+
 func TestIdentifierExpression(t *testing.T) {
     input := "mate;"
 
@@ -360,6 +479,38 @@ func TestParsingInfixExpressions(t *testing.T) {
     }
 }
 
+func TestFloatLiteralExpression(t *testing.T) {
+    tests := []struct {
+        input string
+        expected float64
+    }{
+        {"3.14;", 3.14},
+        {"1e3;", 1000},
+        {"2.5E-2;", 0.025},
+    }
+
+    for _, tt := range tests {
+        lex := lexer.NewLexer(tt.input)
+        p := NewParser(lex)
+        program := p.ParseProgram()
+        checkParserErrors(t, p)
+
+        stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+        if !ok {
+            t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T", program.Statements[0])
+        }
+
+        literal, ok := stmt.Expression.(*ast.FloatLiteral)
+        if !ok {
+            t.Fatalf("exp not *ast.FloatLiteral. got=%T", stmt.Expression)
+        }
+
+        if literal.Value != tt.expected {
+            t.Errorf("literal.Value not %g. got=%g", tt.expected, literal.Value)
+        }
+    }
+}
+
 func TestOperatorPrecedenceParsing(t *testing.T) {
     tests := []struct {
         input string
@@ -392,6 +543,20 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
         {"add(a + b + c * d / f + g)", "add((((a + b) + ((c * d) / f)) + g))"},
         {"a * [1, 2, 3, 4][b * c] * d", "((a * ([1, 2, 3, 4][(b * c)])) * d)"},
         {"add(a * b[2], b[1], 2 * [1, 2][1])", "add((a * (b[2])), (b[1]), (2 * ([1, 2][1])))"},
+        {"-1.5 * 2e2 + a", "(((-1.5) * 2e2) + a)"},
+        {"a <= b == c >= d", "((a <= b) == (c >= d))"},
+        {"a + b % c", "(a + (b % c))"},
+        {"a | b & c", "(a | (b & c))"},
+        {"a ^ b << c", "(a ^ (b << c))"},
+        {"a & 1 == 0", "((a & 1) == 0)"},
+        {"~a >> b", "((~a) >> b)"},
+        {"a || b && c", "(a || (b && c))"},
+        {"a && b || c && d", "((a && b) || (c && d))"},
+        {"a == 1 && !b", "((a == 1) && (!b))"},
+        {"x = a || b", "x = (a || b)"},
+        {"a = b + 1", "a = (b + 1)"},
+        {"a = b = c == d", "a = b = (c == d)"},
+        {"a[i + 1] = b[i]", "(a[(i + 1)]) = (b[i])"},
     }
 
     for _, tt := range tests {
@@ -456,6 +621,169 @@ func TestBooleanExpression(t *testing.T) {
     }
 }
 
+func TestWhileStatement(t *testing.T) {
+    input := "while (x < y) { x; break; continue; }"
+
+    lex := lexer.NewLexer(input)
+    p := NewParser(lex)
+    program := p.ParseProgram()
+    checkParserErrors(t, p)
+
+    if len(program.Statements) != 1 {
+        t.Fatalf("program has not enough statements. got=%d", len(program.Statements))
+    }
+
+    stmt, ok := program.Statements[0].(*ast.WhileStatement)
+    if !ok {
+        t.Fatalf("program.Statements[0] is not ast.WhileStatement. got=%T", program.Statements[0])
+    }
+
+    if !testInfixExpression(t, stmt.Condition, "x", "<", "y") {
+        return
+    }
+
+    if len(stmt.Body.Statements) != 3 {
+        t.Fatalf("body is not 3 statements. got=%d", len(stmt.Body.Statements))
+    }
+
+    if _, ok := stmt.Body.Statements[1].(*ast.BreakStatement); !ok {
+        t.Errorf("Statements[1] is not ast.BreakStatement. got=%T", stmt.Body.Statements[1])
+    }
+
+    if _, ok := stmt.Body.Statements[2].(*ast.ContinueStatement); !ok {
+        t.Errorf("Statements[2] is not ast.ContinueStatement. got=%T", stmt.Body.Statements[2])
+    }
+}
+
+func TestForStatement(t *testing.T) {
+    tests := []struct {
+        input string
+        expectedKey string
+        expectedValue string
+        expectedString string
+    }{
+        {"for (x in xs) { x; break; }", "", "x", "for (x in xs) xbreak;"},
+        {"for (k, v in [1, 2]) { continue; }", "k", "v", "for (k, v in [1, 2]) continue;"},
+    }
+
+    for _, tt := range tests {
+        lex := lexer.NewLexer(tt.input)
+        p := NewParser(lex)
+        program := p.ParseProgram()
+        checkParserErrors(t, p)
+
+        if len(program.Statements) != 1 {
+            t.Fatalf("program has not enough statements. got=%d", len(program.Statements))
+        }
+
+        stmt, ok := program.Statements[0].(*ast.ForStatement)
+        if !ok {
+            t.Fatalf("program.Statements[0] is not ast.ForStatement. got=%T", program.Statements[0])
+        }
+
+        if tt.expectedKey == "" {
+            if stmt.Key != nil {
+                t.Errorf("stmt.Key is not nil. got=%q", stmt.Key.Value)
+            }
+        } else if !testIdentifier(t, stmt.Key, tt.expectedKey) {
+            return
+        }
+
+        if !testIdentifier(t, stmt.Value, tt.expectedValue) {
+            return
+        }
+
+        if stmt.String() != tt.expectedString {
+            t.Errorf("stmt.String() wrong. expected=%q, got=%q", tt.expectedString, stmt.String())
+        }
+    }
+}
+
+func TestAssignExpression(t *testing.T) {
+    input := `h["k"] = 5;`
+
+    lex := lexer.NewLexer(input)
+    p := NewParser(lex)
+    program := p.ParseProgram()
+    checkParserErrors(t, p)
+
+    stmt := program.Statements[0].(*ast.ExpressionStatement)
+    assign, ok := stmt.Expression.(*ast.AssignExpression)
+    if !ok {
+        t.Fatalf("stmt.Expression is not ast.AssignExpression. got=%T", stmt.Expression)
+    }
+
+    target, ok := assign.Target.(*ast.IndexExpression)
+    if !ok {
+        t.Fatalf("assign.Target is not ast.IndexExpression. got=%T", assign.Target)
+    }
+
+    if !testIdentifier(t, target.Left, "h") {
+        return
+    }
+
+    if !testIntegerLiteral(t, assign.Value, 5) {
+        return
+    }
+}
+
+func TestInvalidAssignmentTarget(t *testing.T) {
+    tests := []struct {
+        input string
+        expectedError string
+    }{
+        {"1 = 2", "1:3: cannot assign to 1"},
+        {"a + b = 2", "1:7: cannot assign to (a + b)"},
+        {"f() = 2", "1:5: cannot assign to f()"},
+    }
+
+    for _, tt := range tests {
+        l := lexer.NewLexer(tt.input)
+        p := NewParser(l)
+        p.ParseProgram()
+
+        errors := p.Errors()
+        if len(errors) == 0 {
+            t.Errorf("expected parser errors for %q, got none", tt.input)
+            continue
+        }
+
+        if errors[0] != tt.expectedError {
+            t.Errorf("wrong error for %q. expected=%q, got=%q", tt.input, tt.expectedError, errors[0])
+        }
+    }
+}
+
+func TestLoopControlOutsideLoop(t *testing.T) {
+    tests := []struct {
+        input string
+        expectedError string
+    }{
+        {"break;", "1:1: break outside of a loop"},
+        {"if (true) { continue; }", "1:13: continue outside of a loop"},
+        {"while (true) { fn() { break; } }", "1:23: break outside of a loop"},
+        {"while (true) { 1", "1:17: expected {}} to close the block, got {EOF} instead"},
+        {"for (x in xs) { fn() { continue; } }", "1:24: continue outside of a loop"},
+        {"for (x xs) {}", "1:8: expected next token to be {IN}, got {IDENT} instead"},
+    }
+
+    for _, tt := range tests {
+        l := lexer.NewLexer(tt.input)
+        p := NewParser(l)
+        p.ParseProgram()
+
+        errors := p.Errors()
+        if len(errors) == 0 {
+            t.Errorf("expected parser errors for %q, got none", tt.input)
+            continue
+        }
+
+        if errors[0] != tt.expectedError {
+            t.Errorf("wrong parser error. want=%q, got=%q", tt.expectedError, errors[0])
+        }
+    }
+}
+
 func TestIfExpression(t *testing.T) {
     input := "if (x < y) { x }"
 
@@ -638,6 +966,270 @@ func TestFunctionParameterParsing(t *testing.T) {
     }
 }
 
+func TestDefaultAndRestParameters(t *testing.T) {
+    tests := []struct {
+        input string
+        expected string
+    }{
+        {"fn(a, b = 10) { a }", "fn(a, b = 10) a"},
+        {"fn(a = 1 + 2, b = a * 2) { a }", "fn(a = (1 + 2), b = (a * 2)) a"},
+        {"fn(...rest) { rest }", "fn(...rest) rest"},
+        {"fn(a, b = 10, ...rest) { rest }", "fn(a, b = 10, ...rest) rest"},
+    }
+
+    for _, tt := range tests {
+        lex := lexer.NewLexer(tt.input)
+        p := NewParser(lex)
+        program := p.ParseProgram()
+        checkParserErrors(t, p)
+
+        stmt := program.Statements[0].(*ast.ExpressionStatement)
+        function := stmt.Expression.(*ast.FunctionLiteral)
+
+        if len(function.Defaults) != len(function.Parameters) {
+            t.Errorf("want a default slot per parameter. got %d defaults for %d parameters",
+                len(function.Defaults), len(function.Parameters))
+        }
+
+        if function.String() != tt.expected {
+            t.Errorf("expected=%q, got=%q", tt.expected, function.String())
+        }
+    }
+}
+
+func TestParameterErrors(t *testing.T) {
+    tests := []struct {
+        input string
+        expectedError string
+    }{
+        {"fn(a = 1, b) { a }", "1:11: parameter b needs a default value, it follows one that has one"},
+        {"fn(...rest, a) { a }", "1:13: ...rest must be the last parameter"},
+        {"fn(...rest = []) { rest }", "1:12: expected next token to be {,}, got {=} instead"},
+        {"fn(1) { }", "1:4: expected next token to be {IDENT}, got {INT} instead"},
+        {"fn(a b) { }", "1:6: expected next token to be {,}, got {IDENT} instead"},
+    }
+
+    for _, tt := range tests {
+        l := lexer.NewLexer(tt.input)
+        p := NewParser(l)
+        p.ParseProgram()
+
+        errors := p.Errors()
+        if len(errors) == 0 {
+            t.Errorf("expected parser errors for %q, got none", tt.input)
+            continue
+        }
+
+        if errors[0] != tt.expectedError {
+            t.Errorf("wrong error for %q. expected=%q, got=%q", tt.input, tt.expectedError, errors[0])
+        }
+    }
+}
+
+func TestImportAndExport(t *testing.T) {
+    tests := []struct {
+        input string
+        expected string
+    }{
+        {`import "lib/math.monkey"`, `import "lib/math.monkey"`},
+        {`let m = import "../m.monkey"; m.add(1, 2)`, `let m = import "../m.monkey";(m.add)(1, 2)`},
+        {"a.b.c", "((a.b).c)"},
+        {"-m.x * 2", "((-(m.x)) * 2)"},
+        {"m.xs[0]", "((m.xs)[0])"},
+        {"h.x = 1", "(h.x) = 1"},
+        {"export let x = 1;", "export let x = 1;"},
+        {"export let [a, ...b] = xs;", "export let [a, ...b] = xs;"},
+    }
+
+    for _, tt := range tests {
+        l := lexer.NewLexer(tt.input)
+        p := NewParser(l)
+        program := p.ParseProgram()
+        checkParserErrors(t, p)
+
+        if program.String() != tt.expected {
+            t.Errorf("expected=%q, got=%q", tt.expected, program.String())
+        }
+    }
+
+    program := NewParser(lexer.NewLexer("export let a = 1; let b = 2; export let {c, d} = h;")).ParseProgram()
+    exports := []string{}
+    for _, name := range program.Exports() {
+        exports = append(exports, name.Value)
+    }
+    if strings.Join(exports, ", ") != "a, c, d" {
+        t.Errorf("wrong exports. want=%q, got=%q", "a, c, d", strings.Join(exports, ", "))
+    }
+}
+
+func TestImportAndExportErrors(t *testing.T) {
+    tests := []struct {
+        input string
+        expectedError string
+    }{
+        {"export fn() {}", "1:8: expected next token to be {LET}, got {FUNCTION} instead"},
+        {"if (true) { export let x = 1; }", "1:13: export is only allowed at the top level"},
+        {"let f = fn() { export let x = 1; }", "1:16: export is only allowed at the top level"},
+        {"import lib", "1:8: expected next token to be {STRING}, got {IDENT} instead"},
+        {"m.1", "1:3: expected next token to be {IDENT}, got {INT} instead"},
+    }
+
+    for _, tt := range tests {
+        l := lexer.NewLexer(tt.input)
+        p := NewParser(l)
+        p.ParseProgram()
+
+        errors := p.Errors()
+        if len(errors) == 0 {
+            t.Errorf("expected parser errors for %q, got none", tt.input)
+            continue
+        }
+
+        if errors[0] != tt.expectedError {
+            t.Errorf("wrong error for %q. expected=%q, got=%q", tt.input, tt.expectedError, errors[0])
+        }
+    }
+}
+
+func TestTryAndThrow(t *testing.T) {
+    tests := []struct {
+        input string
+        expected string
+    }{
+        {"try { a; } catch (e) { b; }", "try a catch (e) b"},
+        {"try { a; } finally { c; }", "try a finally c"},
+        {"try { a; } catch (err) { b; } finally { c; }", "try a catch (err) b finally c"},
+        {`throw "boom";`, `throw "boom";`},
+        {"throw {\"message\": x};", "throw {\"message\":x};"},
+    }
+
+    for _, tt := range tests {
+        l := lexer.NewLexer(tt.input)
+        p := NewParser(l)
+        program := p.ParseProgram()
+        checkParserErrors(t, p)
+
+        if program.String() != tt.expected {
+            t.Errorf("expected=%q, got=%q", tt.expected, program.String())
+        }
+    }
+}
+
+func TestTryAndThrowErrors(t *testing.T) {
+    tests := []struct {
+        input string
+        expectedError string
+    }{
+        {"try { a; }", "1:11: expected catch or finally after the try block, got {EOF} instead"},
+        {"try { a; } catch { b; }", "1:18: expected next token to be {(}, got {{} instead"},
+        {"try { a; } catch (1) { b; }", "1:19: expected next token to be {IDENT}, got {INT} instead"},
+        {"try a", "1:5: expected next token to be {{}, got {IDENT} instead"},
+    }
+
+    for _, tt := range tests {
+        l := lexer.NewLexer(tt.input)
+        p := NewParser(l)
+        p.ParseProgram()
+
+        errors := p.Errors()
+        if len(errors) == 0 {
+            t.Errorf("expected parser errors for %q, got none", tt.input)
+            continue
+        }
+
+        if errors[0] != tt.expectedError {
+            t.Errorf("wrong error for %q. expected=%q, got=%q", tt.input, tt.expectedError, errors[0])
+        }
+    }
+}
+
+func TestMatchExpression(t *testing.T) {
+    tests := []struct {
+        input string
+        expected string
+    }{
+        {"match (x) { 1 => a, _ => b }", "match (x) { 1 => a, _ => b }"},
+        {"match (x) { 1 => a, _ => b, }", "match (x) { 1 => a, _ => b }"},
+        {"match (x) { }", "match (x) {  }"},
+        {`match (f(x)) { -1 => a, -2.5 => b, "s" => c, true => d }`, `match (f(x)) { (-1) => a, (-2.5) => b, "s" => c, true => d }`},
+        {"match (x) { [a, [b, _], ...rest] => a }", "match (x) { [a, [b, _], ...rest] => a }"},
+        {`match (x) { {"type": "pt", x, 1: [y]} => x + y }`, `match (x) { {"type": "pt", "x": x, 1: [y]} => (x + y) }`},
+        {"match (x) { n if (n > 1) => n * 2, n if n < 0 => 0 }", "match (x) { n if (n > 1) => (n * 2), n if (n < 0) => 0 }"},
+        {"let y = match (x) { _ => {\"a\": 1} };", "let y = match (x) { _ => {\"a\":1} };"},
+    }
+
+    for _, tt := range tests {
+        l := lexer.NewLexer(tt.input)
+        p := NewParser(l)
+        program := p.ParseProgram()
+        checkParserErrors(t, p)
+
+        if program.String() != tt.expected {
+            t.Errorf("expected=%q, got=%q", tt.expected, program.String())
+        }
+    }
+}
+
+func TestMatchExpressionErrors(t *testing.T) {
+    tests := []struct {
+        input string
+        expectedError string
+    }{
+        {"match x { _ => 1 }", "1:7: expected next token to be {(}, got {IDENT} instead"},
+        {"match (x) { 1 + 2 => 1 }", "1:15: expected next token to be {=>}, got {+} instead"},
+        {"match (x) { f(y) => 1 }", "1:14: expected next token to be {=>}, got {(} instead"},
+        {"match (x) { -y => 1 }", "1:14: expected a number after - in a pattern, got {IDENT} instead"},
+        {"match (x) { (1) => 1 }", "1:13: expected a pattern, got {(} instead"},
+        {"match (x) { [...r, a] => 1 }", "1:20: ...r must be the last element of the pattern"},
+        {"match (x) { {y: 1} => 1 }", "1:15: expected next token to be {,}, got {:} instead"},
+        {"match (x) { {[1]: y} => 1 }", "1:14: expected a string, integer or boolean key in the pattern, got {[} instead"},
+        {"match (x) { 1 => 1 2 => 2 }", "1:20: expected next token to be {,}, got {INT} instead"},
+    }
+
+    for _, tt := range tests {
+        l := lexer.NewLexer(tt.input)
+        p := NewParser(l)
+        p.ParseProgram()
+
+        errors := p.Errors()
+        if len(errors) == 0 {
+            t.Errorf("expected parser errors for %q, got none", tt.input)
+            continue
+        }
+
+        if errors[0] != tt.expectedError {
+            t.Errorf("wrong error for %q. expected=%q, got=%q", tt.input, tt.expectedError, errors[0])
+        }
+    }
+}
+
+func TestFunctionLiteralWithName(t *testing.T) {
+    input := `let myFunction = fn() { };`
+
+    l := lexer.NewLexer(input)
+    p := NewParser(l)
+    program := p.ParseProgram()
+    checkParserErrors(t, p)
+
+    if len(program.Statements) != 1 {
+        t.Fatalf("program.Statements does not contain %d statements. got=%d\n", 1, len(program.Statements))
+    }
+
+    stmt, ok := program.Statements[0].(*ast.LetStatement)
+    if !ok {
+        t.Fatalf("program.Statements[0] is not ast.LetStatement. got=%T", program.Statements[0])
+    }
+
+    function, ok := stmt.Value.(*ast.FunctionLiteral)
+    if !ok {
+        t.Fatalf("stmt.Value is not ast.FunctionLiteral. got=%T", stmt.Value)
+    }
+
+    if function.Name != "myFunction" {
+        t.Fatalf("function literal name wrong. want 'myFunction', got=%q\n", function.Name)
+    }
+}
+
 func TestCallExpressionParsing(t *testing.T) {
     input := "add(1, 2 * 3, 4 + 5);"
 
@@ -692,6 +1284,68 @@ func TestSTringLIteralExpression(t *testing.T) {
     }
 }
 
+func TestEscapedAndRawStringLiterals(t *testing.T) {
+    tests := []struct {
+        input string
+        expected string
+    }{
+        {`"tab\there\n";`, "tab\there\n"},
+        {`"\"quoted\"";`, `"quoted"`},
+        {"`C:\\path\\n`;", `C:\path\n`},
+        {"`two\nlines`;", "two\nlines"},
+    }
+
+    for _, tt := range tests {
+        lex := lexer.NewLexer(tt.input)
+        p := NewParser(lex)
+        program := p.ParseProgram()
+        checkParserErrors(t, p)
+
+        stmt := program.Statements[0].(*ast.ExpressionStatement)
+        literal, ok := stmt.Expression.(*ast.StringLiteral)
+        if !ok {
+            t.Fatalf("exp not *ast.StringLiteral. got=%T", stmt.Expression)
+        }
+
+        if literal.Value != tt.expected {
+            t.Errorf("literal.Value not %q. got=%q", tt.expected, literal.Value)
+        }
+    }
+}
+
+func TestInterpolatedString(t *testing.T) {
+    input := `"sum: ${a + b}, ${c}!"`
+
+    lex := lexer.NewLexer(input)
+    p := NewParser(lex)
+    program := p.ParseProgram()
+    checkParserErrors(t, p)
+
+    stmt := program.Statements[0].(*ast.ExpressionStatement)
+    str, ok := stmt.Expression.(*ast.InterpolatedString)
+    if !ok {
+        t.Fatalf("exp not *ast.InterpolatedString. got=%T", stmt.Expression)
+    }
+
+    if len(str.Parts) != 5 {
+        t.Fatalf("wrong number of parts. expected=5, got=%d", len(str.Parts))
+    }
+
+    for i, text := range map[int]string{0: "sum: ", 2: ", ", 4: "!"} {
+        literal, ok := str.Parts[i].(*ast.StringLiteral)
+        if !ok || literal.Value != text {
+            t.Errorf("part %d is not the text %q. got=%s", i, text, str.Parts[i])
+        }
+    }
+
+    testInfixExpression(t, str.Parts[1], "a", "+", "b")
+    testIdentifier(t, str.Parts[3], "c")
+
+    if str.String() != `"sum: ${(a + b)}, ${c}!"` {
+        t.Errorf("str.String() wrong. got=%s", str.String())
+    }
+}
+
 func TestArrayLiteralExpression(t *testing.T) {
     input := "[1, 2 * 2, 3 + 3]"
 
@@ -17,11 +17,19 @@ import (
 const PROMPT = "$ "
 
 func Start(in io.Reader, out io.Writer) {
+    Start_With_Options(in, out, vm.Options{})
+}
+
+// Start_With_Options runs the REPL with the given vm limits, every line gets a vm with them
+func Start_With_Options(in io.Reader, out io.Writer, opts vm.Options) {
     scanner := bufio.NewScanner(in)
     // env := object.NewEnvironment()
     constants := []object.Object{}
-    globals := make([]object.Object, vm.GlobalSize)
+    opts.Globals = make([]object.Object, vm.GlobalSize)
     symTable := compiler.NewSymTable()
+    for i, b := range object.Builtins {
+        symTable.DefineBuiltin(i, b.Name)
+    }
 
     for {
         fmt.Print(PROMPT)
@@ -46,10 +54,10 @@ func Start(in io.Reader, out io.Writer) {
             continue
         }
 
-        virt_machine := vm.New_VM_With_Global_Store(comp.Bytecode(), globals)
+        virt_machine := vm.New_VM_With_Options(comp.Bytecode(), opts)
         err = virt_machine.Run()
         if err != nil {
-            fmt.Fprintf(out, "Execution failed:\n %s\n", err)
+            PrintRuntimeError(out, err)
             continue
         }
 
@@ -74,6 +82,15 @@ func Start(in io.Reader, out io.Writer) {
     }
 }
 
+func PrintRuntimeError(out io.Writer, err error) {
+    io.WriteString(out, "Execution failed:\n ")
+    if runtimeErr, ok := err.(*vm.RuntimeError); ok {
+        io.WriteString(out, runtimeErr.StackTrace() + "\n")
+    } else {
+        io.WriteString(out, err.Error() + "\n")
+    }
+}
+
 func PrintParserErrors(out io.Writer, errors []string) {
     io.WriteString(out, "seems like you suck at writing monkey!\n")
     io.WriteString(out, " parser errors:\n")
@@ -1,11 +1,18 @@
 package token
 
+import "fmt"
+
 const (
-	ILLEGAL = "ILLEGAL"
+	ILLEGAL = "ILLEGAL" // the literal is either the unknown character or what the lexer complains about
 	EOF     = "EOF"
 	// Identifiers + literals
 	IDENT  = "IDENT" // add, foobar, x, y, ...
     INT    = "INT"   // 1343456
+    FLOAT  = "FLOAT" // 3.14, 1e-9
+    // "a ${x} b ${y} c" is lexed as INTERP_START("a "), x, INTERP_MID(" b "), y, INTERP_END(" c")
+    INTERP_START = "INTERP_START"
+    INTERP_MID   = "INTERP_MID"
+    INTERP_END   = "INTERP_END"
     STRING = "STRING" // "mate", "mamad"
 	// Operators
 	ASSIGN = "="
@@ -18,9 +25,23 @@ const (
     GT       = ">"
     EQ       = "=="
     NOT_EQ   = "!="
+    AND      = "&&"
+    OR       = "||"
+    LT_EQ    = "<="
+    GT_EQ    = ">="
+    PERCENT  = "%"
+    AMPERSAND = "&"
+    PIPE     = "|"
+    CARET    = "^"
+    TILDE    = "~"
+    SHL      = "<<"
+    SHR      = ">>"
 	// Delimiters
 	COMMA     = ","
     COLON     = ":"
+    ELLIPSIS  = "..."
+    ARROW     = "=>"
+    DOT       = "."
 	SEMICOLON = ";"
 	LPAREN    = "("
 	RPAREN    = ")"
@@ -36,6 +57,18 @@ const (
     RETURN   = "RETURN"
     TRUE     = "TRUE"
     FALSE    = "FALSE"
+    WHILE    = "WHILE"
+    BREAK    = "BREAK"
+    CONTINUE = "CONTINUE"
+    FOR      = "FOR"
+    IN       = "IN"
+    IMPORT   = "IMPORT"
+    EXPORT   = "EXPORT"
+    TRY      = "TRY"
+    CATCH    = "CATCH"
+    FINALLY  = "FINALLY"
+    THROW    = "THROW"
+    MATCH    = "MATCH"
 )
 
 var keywords = map[string]TokenType{
@@ -46,6 +79,18 @@ var keywords = map[string]TokenType{
     "return": RETURN,
     "true": TRUE,
     "false": FALSE,
+    "while": WHILE,
+    "break": BREAK,
+    "continue": CONTINUE,
+    "for": FOR,
+    "in": IN,
+    "import": IMPORT,
+    "export": EXPORT,
+    "try": TRY,
+    "catch": CATCH,
+    "finally": FINALLY,
+    "throw": THROW,
+    "match": MATCH,
 }
 
 type TokenType string
@@ -53,9 +98,37 @@ type TokenType string
 type Token struct {
 	Type    TokenType
 	Literal string
+	Pos     Position
+
+	Comments []Comment // the comments between the previous token and this one
+}
+
+// Comment is a // or /* */ comment, Text includes the slashes and stars
+type Comment struct {
+	Text string
+	Pos  Position
+}
+
+// Position is where a token starts in the source. Line and Column are 1-based.
+type Position struct {
+	File   string
+	Line   int
+	Column int
+}
+
+// IsValid reports whether the position was actually set by the lexer.
+func (p Position) IsValid() bool {
+	return p.Line > 0
+}
+
+func (p Position) String() string {
+	if p.File == "" {
+		return fmt.Sprintf("%d:%d", p.Line, p.Column)
+	}
+	return fmt.Sprintf("%s:%d:%d", p.File, p.Line, p.Column)
 }
 
-func NewToken(tokenType TokenType, ch byte) Token {
+func NewToken(tokenType TokenType, ch rune) Token {
 	return Token{Type: tokenType, Literal: string(ch)}
 }
 
@@ -0,0 +1,94 @@
+package vm
+
+import (
+    "bytes"
+    "fmt"
+    "monkey/object"
+    "monkey/token"
+)
+
+// RuntimeError is what Run returns when execution fails. Frames holds the call
+// stack at the moment of the failure, innermost frame first.
+type RuntimeError struct {
+    Message string
+    Pos token.Position
+    Frames []TraceFrame
+}
+
+type TraceFrame struct {
+    Function string
+    Pos token.Position
+}
+
+func (e *RuntimeError) Error() string {
+    if e.Pos.IsValid() {
+        return fmt.Sprintf("%s: %s", e.Pos, e.Message)
+    }
+    return e.Message
+}
+
+func (e *RuntimeError) StackTrace() string {
+    var out bytes.Buffer
+
+    out.WriteString(e.Error())
+    for i := 0; i < len(e.Frames); {
+        frame := e.Frames[i]
+
+        // deep recursion repeats the same frame over and over, it's written once with a count
+        repeats := 1
+        for i+repeats < len(e.Frames) && e.Frames[i+repeats] == frame {
+            repeats++
+        }
+        i += repeats
+
+        if frame.Pos.IsValid() {
+            fmt.Fprintf(&out, "\n\tat %s (%s)", frame.Function, frame.Pos)
+        } else {
+            fmt.Fprintf(&out, "\n\tat %s", frame.Function)
+        }
+        if repeats > 1 {
+            fmt.Fprintf(&out, " ×%d", repeats)
+        }
+    }
+
+    return out.String()
+}
+
+// thrown is the error OpThrow raises, a catch gets the value back as it was
+type thrown struct {
+    value object.Object
+}
+
+func (t *thrown) Error() string {
+    message, _ := object.UncaughtException(t.value, token.Position{})
+    return message
+}
+
+func (vm *VM) newRuntimeError(err error) *RuntimeError {
+    if rtErr, ok := err.(*RuntimeError); ok { // rethrown, it already has its trace
+        return rtErr
+    }
+
+    frames := make([]TraceFrame, 0, vm.framesIndex)
+
+    for i := vm.framesIndex - 1; i >= 0; i-- {
+        frame := vm.frames[i]
+        fn := frame.cl.Fn
+
+        name := fn.Name
+        if i == 0 {
+            name = "<main>"
+        } else if name == "" {
+            name = "<anonymous>"
+        }
+
+        frames = append(frames, TraceFrame{Function: name, Pos: fn.Positions.Lookup(frame.ip)})
+    }
+
+    if t, ok := err.(*thrown); ok {
+        message, pos := object.UncaughtException(t.value, frames[0].Pos)
+        return &RuntimeError{Message: message, Pos: pos, Frames: frames}
+    }
+
+    return &RuntimeError{Message: err.Error(), Pos: frames[0].Pos, Frames: frames}
+}
@@ -6,15 +6,16 @@ import (
 )
 
 type Frame struct {
-    fun *object.CompiledFunction
+    cl *object.Closure
     ip int
     basePtr int // for storing the start of the calling frame on the stack
+    numArgs int // how many arguments the call passed, defaults are only run for the missing ones
 }
 
-func New_Frame(fun *object.CompiledFunction, basePtr int) *Frame {
-    return &Frame{fun: fun, ip: -1, basePtr: basePtr}
+func New_Frame(cl *object.Closure, basePtr int) *Frame {
+    return &Frame{cl: cl, ip: -1, basePtr: basePtr}
 }
 
 func (f *Frame) Instructions() code.Instructions {
-    return f.fun.Instructions
+    return f.cl.Fn.Instructions
 }
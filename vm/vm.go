@@ -2,19 +2,33 @@ package vm
 
 import (
 	"fmt"
+	"math"
 	"monkey/code"
 	"monkey/compiler"
 	"monkey/object"
+	"strings"
 )
 
 var True = &object.Boolean{Value: true}
 var False = &object.Boolean{Value: false}
 var Null = &object.Null{}
 
+// the default limits, Options can change the stack and frame ones
 const StackSize = 2048
 const GlobalSize = 65536
 const MaxFrames = 1024
 
+// the stack and the frames start this small and grow when they run out, up to their limits
+const initialStackSize = 64
+const initialFrames = 16
+
+// Options are the limits of a VM, a field left at zero gets the default
+type Options struct {
+    MaxStackSize int // slots of the value stack, StackSize by default
+    MaxFrames int // how deep calls can go, the main frame included. MaxFrames by default
+    Globals []object.Object // a store kept between runs, like the REPL's. a new one of GlobalSize when nil
+}
+
 type VM struct {
     constants []object.Object
     stack []object.Object
@@ -23,29 +37,63 @@ type VM struct {
     globals []object.Object
     frames []*Frame
     framesIndex int
+    maxStackSize int
+    maxFrames int
+    handlers []handler // the try blocks being executed, innermost last
+    caught caught // the last error a handler got, so a finally can rethrow it as it was
+}
+
+// caught is the exception a handler last got and the error it came from
+type caught struct {
+    exception object.Object
+    err *RuntimeError
+}
+
+// handler is where an error goes while a try block runs, and what to unwind to
+type handler struct {
+    catchPos int
+    framesIndex int
+    sp int
 }
 
 func New_VM(bytecode *compiler.Bytecode) *VM {
-    mainFun := &object.CompiledFunction{Instructions: bytecode.Instructions}
-    mainFrame := New_Frame(mainFun, 0)
+    return New_VM_With_Options(bytecode, Options{})
+}
 
-    frames := make([]*Frame, MaxFrames)
+func New_VM_With_Options(bytecode *compiler.Bytecode, opts Options) *VM {
+    if opts.MaxStackSize <= 0 {
+        opts.MaxStackSize = StackSize
+    }
+    if opts.MaxFrames <= 0 {
+        opts.MaxFrames = MaxFrames
+    }
+
+    mainFun := &object.CompiledFunction{Instructions: bytecode.Instructions, Positions: bytecode.Positions}
+    mainClosure := &object.Closure{Fn: mainFun}
+    mainFrame := New_Frame(mainClosure, 0)
+
+    frames := make([]*Frame, 1, min(initialFrames, opts.MaxFrames))
     frames[0] = mainFrame
 
+    globals := opts.Globals
+    if globals == nil {
+        globals = make([]object.Object, GlobalSize)
+    }
+
     return &VM{
         constants: bytecode.Constants,
-        stack: make([]object.Object, StackSize),
+        stack: make([]object.Object, min(initialStackSize, opts.MaxStackSize)),
         sp: 0,
-        globals: make([]object.Object, GlobalSize),
+        globals: globals,
         frames: frames,
         framesIndex: 1,
+        maxStackSize: opts.MaxStackSize,
+        maxFrames: opts.MaxFrames,
     }
 }
 
 func New_VM_With_Global_Store(bytecode *compiler.Bytecode, s []object.Object) *VM {
-    vm := New_VM(bytecode)
-    vm.globals = s
-    return vm
+    return New_VM_With_Options(bytecode, Options{Globals: s})
 }
 
 func (vm *VM) LastPopped() object.Object {
@@ -53,8 +101,9 @@ func (vm *VM) LastPopped() object.Object {
 }
 
 func (vm *VM) push(obj object.Object) error {
-    if vm.sp >= StackSize { // StackSize is 2048 and we set limit to 2047 as we start from 0
-        return fmt.Errorf("Stack Overflow")
+    err := vm.ensureStack(vm.sp + 1)
+    if err != nil {
+        return err
     }
     vm.stack[vm.sp] = obj
     vm.sp++;
@@ -62,6 +111,43 @@ func (vm *VM) push(obj object.Object) error {
     return nil
 }
 
+// ensureStack makes room for size slots, doubling the stack until they fit
+func (vm *VM) ensureStack(size int) error {
+    if size <= len(vm.stack) {
+        return nil
+    }
+    if size > vm.maxStackSize {
+        return vm.stackOverflow()
+    }
+
+    newSize := len(vm.stack) * 2
+    for newSize < size {
+        newSize *= 2
+    }
+
+    stack := make([]object.Object, min(newSize, vm.maxStackSize))
+    copy(stack, vm.stack)
+    vm.stack = stack
+
+    return nil
+}
+
+// running out of either the stack or the frames is a stack overflow
+func (vm *VM) stackOverflow() error {
+    return fmt.Errorf("stack overflow at depth %d", vm.framesIndex)
+}
+
+func (vm *VM) pushAll(objs []object.Object) error {
+    for _, obj := range objs {
+        err := vm.push(obj)
+        if err != nil {
+            return err
+        }
+    }
+
+    return nil
+}
+
 func (vm *VM) pop() object.Object {
     if vm.sp == 0 {
         return Null
@@ -73,7 +159,64 @@ func (vm *VM) pop() object.Object {
     return obj
 }
 
+// Run executes the bytecode. failures are reported as a *RuntimeError
 func (vm *VM) Run() error {
+    for {
+        err := vm.run()
+        if err == nil {
+            return nil
+        }
+
+        rtErr := vm.newRuntimeError(err)
+        if !vm.catch(err, rtErr) {
+            return rtErr
+        }
+    }
+}
+
+// stop ends the program early with its result where LastPopped finds it
+func (vm *VM) stop(result object.Object) error {
+    err := vm.ensureStack(1)
+    if err != nil {
+        return err
+    }
+
+    vm.sp = 0
+    vm.stack[0] = result
+    vm.currFrame().ip = len(vm.currFrame().Instructions()) - 1
+
+    return nil
+}
+
+// catch unwinds the frames and the stack to the innermost try and goes on at its catch with the
+// exception on the stack. a thrown value is caught as it was, other errors become exception hash maps.
+func (vm *VM) catch(err error, rtErr *RuntimeError) bool {
+    if len(vm.handlers) == 0 {
+        return false
+    }
+
+    h := vm.handlers[len(vm.handlers)-1]
+    vm.handlers = vm.handlers[:len(vm.handlers)-1]
+
+    var exception object.Object
+    switch err := err.(type) {
+    case *thrown:
+        exception = err.value
+    case *RuntimeError: // rethrown by a finally, catch what was caught the first time
+        exception = vm.caught.exception
+    default:
+        exception = object.NewException(rtErr.Message, rtErr.Pos)
+    }
+
+    vm.caught = caught{exception: exception, err: rtErr}
+    vm.framesIndex = h.framesIndex
+    vm.sp = h.sp
+    vm.currFrame().ip = h.catchPos - 1
+
+    return vm.push(exception) == nil
+}
+
+func (vm *VM) run() error {
     var ip int
     var ins code.Instructions
     var op code.Opcode
@@ -104,6 +247,15 @@ func (vm *VM) Run() error {
             if !isTruthy(condition) {
                 vm.currFrame().ip = pos - 1
             }
+        case code.OpJumpIfFalsy, code.OpJumpIfTruthy:
+            pos := int(code.ReadUint16(ins[ip+1:]))
+            vm.currFrame().ip += 2
+
+            if isTruthy(vm.stack[vm.sp-1]) == (op == code.OpJumpIfTruthy) {
+                vm.currFrame().ip = pos - 1
+            } else {
+                vm.pop()
+            }
         case code.OpSetGlobal:
             globalIndex := code.ReadUint16(ins[ip+1:])
             vm.currFrame().ip += 2
@@ -119,17 +271,48 @@ func (vm *VM) Run() error {
                 return err
             }
         case code.OpSetLocal:
+            localIndex := int(code.ReadUint8(ins[ip+1:]))
+            vm.currFrame().ip += 1
+            slot := &vm.stack[vm.currFrame().basePtr + localIndex]
+            if cell, ok := (*slot).(*object.Cell); ok { // captured, the closures see the new value too
+                cell.Value = vm.pop()
+            } else {
+                *slot = vm.pop()
+            }
+        case code.OpBindLocal:
             localIndex := int(code.ReadUint8(ins[ip+1:]))
             vm.currFrame().ip += 1
             vm.stack[vm.currFrame().basePtr + localIndex] = vm.pop()
         case code.OpGetLocal:
             localIndex := int(code.ReadUint8(ins[ip+1:]))
             vm.currFrame().ip += 1
-            err := vm.push(vm.stack[vm.currFrame().basePtr + localIndex])
+
+            value := vm.stack[vm.currFrame().basePtr + localIndex]
+            if cell, ok := value.(*object.Cell); ok {
+                value = cell.Value
+            }
+
+            err := vm.push(value)
+            if err != nil {
+                return err
+            }
+        case code.OpCaptureLocal:
+            localIndex := int(code.ReadUint8(ins[ip+1:]))
+            vm.currFrame().ip += 1
+
+            slot := &vm.stack[vm.currFrame().basePtr + localIndex]
+            cell, ok := (*slot).(*object.Cell)
+            if !ok {
+                cell = &object.Cell{Value: *slot}
+                *slot = cell
+            }
+
+            err := vm.push(cell)
             if err != nil {
                 return err
             }
-        case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv:
+        case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv, code.OpMod,
+            code.OpBitAnd, code.OpBitOr, code.OpBitXor, code.OpShiftLeft, code.OpShiftRight:
             err := vm.executeBinaryOperation(op)
             if err != nil {
                 return err
@@ -144,7 +327,7 @@ func (vm *VM) Run() error {
             if err != nil {
                 return err
             }
-        case code.OpEqual, code.OpLessThan, code.OpNotEqual:
+        case code.OpEqual, code.OpLessThan, code.OpNotEqual, code.OpLessEqual:
             err := vm.executeComparison(op)
             if err != nil {
                 return err
@@ -159,6 +342,18 @@ func (vm *VM) Run() error {
             if err != nil {
                 return err
             }
+        case code.OpBitNot:
+            operand := vm.pop()
+
+            integer, ok := operand.(*object.Integer)
+            if !ok {
+                return fmt.Errorf("unknown operator: ~%s", operand.Type())
+            }
+
+            err := vm.push(&object.Integer{Value: ^integer.Value})
+            if err != nil {
+                return err
+            }
         case code.OpArray:
             numElements := int(code.ReadUint16(ins[ip+1:]))
             vm.currFrame().ip += 2
@@ -194,20 +389,24 @@ func (vm *VM) Run() error {
             numArgs := int(code.ReadUint8(ins[ip+1:]))
             vm.currFrame().ip += 1
 
-            fn, ok := vm.stack[vm.sp - 1 - numArgs].(*object.CompiledFunction)
-            if !ok {
-                return fmt.Errorf("calling non-function")
+            err := vm.executeCall(numArgs)
+            if err != nil {
+                return err
             }
+        case code.OpTailCall:
+            numArgs := int(code.ReadUint8(ins[ip+1:]))
+            vm.currFrame().ip += 1
 
-            if numArgs != fn.NumParams {
-                return fmt.Errorf("wrong number of arguments: want=%d, got=%d", fn.NumParams, numArgs)
+            err := vm.executeTailCall(numArgs)
+            if err != nil {
+                return err
             }
-
-            frame := New_Frame(fn, vm.sp - numArgs)
-            vm.pushFrame(frame)
-            vm.sp = frame.basePtr + fn.NumLocals
         case code.OpReturnValue:
             returnValue := vm.pop()
+            if vm.framesIndex == 1 { // a return at the top level ends the program
+                return vm.stop(returnValue)
+            }
+
             vm.sp = vm.currFrame().basePtr - 1 // -1 because of popping the just executed function.
                                                // used instad of vm.pop()
             vm.popFrame()
@@ -217,6 +416,10 @@ func (vm *VM) Run() error {
                 return err
             }
         case code.OpReturn:
+            if vm.framesIndex == 1 {
+                return vm.stop(Null)
+            }
+
             vm.sp = vm.currFrame().basePtr - 1
             vm.popFrame()
 
@@ -224,6 +427,243 @@ func (vm *VM) Run() error {
             if err != nil {
                 return err
             }
+        case code.OpClosure:
+            constIndex := int(code.ReadUint16(ins[ip+1:]))
+            numFree := int(code.ReadUint8(ins[ip+3:]))
+            vm.currFrame().ip += 3
+
+            err := vm.pushClosure(constIndex, numFree)
+            if err != nil {
+                return err
+            }
+        case code.OpGetFree:
+            freeIndex := int(code.ReadUint8(ins[ip+1:]))
+            vm.currFrame().ip += 1
+
+            value := vm.currFrame().cl.Free[freeIndex]
+            if cell, ok := value.(*object.Cell); ok { // not a cell when it's the enclosing function itself
+                value = cell.Value
+            }
+
+            err := vm.push(value)
+            if err != nil {
+                return err
+            }
+        case code.OpCaptureFree:
+            freeIndex := int(code.ReadUint8(ins[ip+1:]))
+            vm.currFrame().ip += 1
+
+            err := vm.push(vm.currFrame().cl.Free[freeIndex])
+            if err != nil {
+                return err
+            }
+        case code.OpSetFree:
+            freeIndex := int(code.ReadUint8(ins[ip+1:]))
+            vm.currFrame().ip += 1
+
+            vm.currFrame().cl.Free[freeIndex].(*object.Cell).Value = vm.pop()
+        case code.OpGetBuiltin:
+            builtinIndex := int(code.ReadUint8(ins[ip+1:]))
+            vm.currFrame().ip += 1
+
+            definition := object.Builtins[builtinIndex]
+
+            err := vm.push(definition.Builtin)
+            if err != nil {
+                return err
+            }
+        case code.OpBuildString:
+            numParts := int(code.ReadUint16(ins[ip+1:]))
+            vm.currFrame().ip += 2
+
+            var out strings.Builder
+            for _, part := range vm.stack[vm.sp-numParts : vm.sp] {
+                out.WriteString(object.Display(part))
+            }
+            vm.sp = vm.sp - numParts
+
+            err := vm.push(&object.String{Value: out.String()})
+            if err != nil {
+                return err
+            }
+        case code.OpImport:
+            slot := code.ReadUint16(ins[ip+1:])
+            pos := int(code.ReadUint16(ins[ip+3:]))
+            vm.currFrame().ip += 4
+
+            if mod := vm.globals[slot]; mod != nil {
+                vm.currFrame().ip = pos - 1
+
+                err := vm.push(mod)
+                if err != nil {
+                    return err
+                }
+            }
+        case code.OpModule:
+            pathIndex := code.ReadUint16(ins[ip+1:])
+            numExports := int(code.ReadUint16(ins[ip+3:]))
+            vm.currFrame().ip += 4
+
+            mod := &object.Module{Path: vm.constants[pathIndex].(*object.String).Value, Exports: map[string]object.Object{}}
+            for i := vm.sp - 2*numExports; i < vm.sp; i += 2 {
+                mod.Exports[vm.stack[i].(*object.String).Value] = vm.stack[i+1]
+            }
+            vm.sp = vm.sp - 2*numExports
+
+            err := vm.push(mod)
+            if err != nil {
+                return err
+            }
+        case code.OpTry:
+            catchPos := int(code.ReadUint16(ins[ip+1:]))
+            vm.currFrame().ip += 2
+
+            vm.handlers = append(vm.handlers, handler{catchPos: catchPos, framesIndex: vm.framesIndex, sp: vm.sp})
+        case code.OpEndTry:
+            vm.handlers = vm.handlers[:len(vm.handlers)-1]
+        case code.OpThrow:
+            return &thrown{value: vm.pop()}
+        case code.OpRethrow:
+            exception := vm.pop()
+            if exception == vm.caught.exception {
+                return vm.caught.err
+            }
+            return &thrown{value: exception}
+        case code.OpJumpIfArg:
+            pos := int(code.ReadUint16(ins[ip+1:]))
+            param := int(code.ReadUint8(ins[ip+3:]))
+            vm.currFrame().ip += 3
+
+            if param < vm.currFrame().numArgs {
+                vm.currFrame().ip = pos - 1
+            }
+        case code.OpUnpackArray:
+            numElements := int(code.ReadUint16(ins[ip+1:]))
+            hasRest := code.ReadUint8(ins[ip+3:]) == 1
+            vm.currFrame().ip += 3
+
+            values, err := object.UnpackArray(vm.pop(), numElements, hasRest)
+            if err != nil {
+                return err
+            }
+
+            err = vm.pushAll(values)
+            if err != nil {
+                return err
+            }
+        case code.OpUnpackHash:
+            numKeys := int(code.ReadUint16(ins[ip+1:]))
+            vm.currFrame().ip += 2
+
+            keys := []string{}
+            for _, key := range vm.stack[vm.sp-numKeys : vm.sp] {
+                keys = append(keys, key.(*object.String).Value)
+            }
+            vm.sp = vm.sp - numKeys
+
+            values, err := object.UnpackHash(vm.pop(), keys)
+            if err != nil {
+                return err
+            }
+
+            err = vm.pushAll(values)
+            if err != nil {
+                return err
+            }
+        case code.OpMatchLiteral:
+            literal := vm.pop()
+            value := vm.pop()
+
+            err := vm.push(nativeBoolToBooleanObject(object.Equal(value, literal)))
+            if err != nil {
+                return err
+            }
+        case code.OpMatchArray:
+            numElements := int(code.ReadUint16(ins[ip+1:]))
+            hasRest := code.ReadUint8(ins[ip+3:]) == 1
+            vm.currFrame().ip += 3
+
+            err := vm.push(nativeBoolToBooleanObject(object.MatchArray(vm.pop(), numElements, hasRest)))
+            if err != nil {
+                return err
+            }
+        case code.OpMatchHash:
+            numKeys := int(code.ReadUint16(ins[ip+1:]))
+            vm.currFrame().ip += 2
+
+            keys := vm.stack[vm.sp-numKeys : vm.sp]
+            vm.sp = vm.sp - numKeys
+
+            err := vm.push(nativeBoolToBooleanObject(object.MatchHash(vm.pop(), keys)))
+            if err != nil {
+                return err
+            }
+        case code.OpArrayRest:
+            numElements := int(code.ReadUint16(ins[ip+1:]))
+            vm.currFrame().ip += 2
+
+            values, err := object.UnpackArray(vm.pop(), numElements, true)
+            if err != nil {
+                return err
+            }
+
+            err = vm.push(values[numElements])
+            if err != nil {
+                return err
+            }
+        case code.OpNoMatch:
+            return object.NoMatch(vm.pop())
+        case code.OpSetIndex:
+            value := vm.pop()
+            index := vm.pop()
+            left := vm.pop()
+
+            err := vm.executeSetIndex(left, index, value)
+            if err != nil {
+                return err
+            }
+        case code.OpIter:
+            collection := vm.pop()
+
+            iter, ok := object.NewIterator(collection)
+            if !ok {
+                return fmt.Errorf("cannot iterate over %s", collection.Type())
+            }
+
+            err := vm.push(iter)
+            if err != nil {
+                return err
+            }
+        case code.OpIterNext:
+            pos := int(code.ReadUint16(ins[ip+1:]))
+            numVars := int(code.ReadUint8(ins[ip+3:]))
+            vm.currFrame().ip += 3
+
+            iter := vm.pop().(*object.Iterator)
+            key, value, ok := iter.Next()
+            if !ok {
+                vm.currFrame().ip = pos - 1
+                continue
+            }
+
+            if numVars == 2 {
+                err := vm.push(key)
+                if err != nil {
+                    return err
+                }
+            } else {
+                value = iter.Single(key, value)
+            }
+
+            err := vm.push(value)
+            if err != nil {
+                return err
+            }
+        case code.OpCurrentClosure:
+            err := vm.push(vm.currFrame().cl)
+            if err != nil {
+                return err
+            }
         case code.OpPop:
             vm.pop()
         case code.OpNull:
@@ -238,6 +678,132 @@ func (vm *VM) Run() error {
     return nil;
 }
 
+func (vm *VM) executeCall(numArgs int) error {
+    callee := vm.stack[vm.sp - 1 - numArgs]
+
+    switch callee := callee.(type) {
+    case *object.Closure:
+        return vm.callClosure(callee, numArgs)
+    case *object.Builtin:
+        return vm.callBuiltin(callee, numArgs)
+    default:
+        return fmt.Errorf("calling non-function")
+    }
+}
+
+func (vm *VM) callClosure(cl *object.Closure, numArgs int) error {
+    fn := cl.Fn
+
+    err := object.CheckArity(fn.NumParams - fn.NumDefaults, fn.NumParams, fn.Variadic, numArgs)
+    if err != nil {
+        return err
+    }
+
+    frame := New_Frame(cl, vm.sp - numArgs)
+    err = vm.startFrame(frame, numArgs)
+    if err != nil {
+        return err
+    }
+
+    return vm.pushFrame(frame)
+}
+
+// a closure called in tail position takes over the caller's frame, the callee and its arguments
+// are moved down to where the caller's were and the frame starts over. anything else is called
+// as usual, the return after the call is still there for it.
+func (vm *VM) executeTailCall(numArgs int) error {
+    cl, ok := vm.stack[vm.sp - 1 - numArgs].(*object.Closure)
+    if !ok {
+        return vm.executeCall(numArgs)
+    }
+
+    fn := cl.Fn
+    err := object.CheckArity(fn.NumParams - fn.NumDefaults, fn.NumParams, fn.Variadic, numArgs)
+    if err != nil {
+        return err
+    }
+
+    frame := vm.currFrame()
+    copy(vm.stack[frame.basePtr - 1:], vm.stack[vm.sp - 1 - numArgs : vm.sp])
+    vm.sp = frame.basePtr + numArgs
+
+    frame.cl = cl
+    frame.ip = -1
+
+    return vm.startFrame(frame, numArgs)
+}
+
+// startFrame sets up the locals of a frame whose arguments are already on the stack at its basePtr
+func (vm *VM) startFrame(frame *Frame, numArgs int) error {
+    fn := frame.cl.Fn
+    frame.numArgs = numArgs
+
+    err := vm.ensureStack(frame.basePtr + fn.NumLocals)
+    if err != nil {
+        return err
+    }
+
+    // the extra arguments become the ...rest array, which sits right after the other parameters
+    var rest *object.Array
+    if fn.Variadic {
+        rest = &object.Array{Elements: []object.Object{}}
+        if numArgs > fn.NumParams {
+            rest.Elements = append(rest.Elements, vm.stack[frame.basePtr + fn.NumParams : vm.sp]...)
+        }
+    }
+
+    // left out parameters are null until their default runs
+    for i := numArgs; i < fn.NumParams; i++ {
+        vm.stack[frame.basePtr + i] = Null
+    }
+    firstLocal := fn.NumParams
+    if rest != nil {
+        vm.stack[frame.basePtr + fn.NumParams] = rest
+        firstLocal++
+    }
+
+    // a slot could still hold a cell from an earlier call, storing to it would change that call's closures
+    clear(vm.stack[frame.basePtr + firstLocal : frame.basePtr + fn.NumLocals])
+
+    vm.sp = frame.basePtr + fn.NumLocals
+
+    return nil
+}
+
+func (vm *VM) callBuiltin(builtin *object.Builtin, numArgs int) error {
+    args := vm.stack[vm.sp - numArgs : vm.sp]
+
+    result := builtin.Fn(args...)
+    vm.sp = vm.sp - numArgs - 1 // -1 because of the builtin itself
+
+    // like in the evaluator, an error from a builtin aborts the program
+    if errObj, ok := result.(*object.Error); ok {
+        return fmt.Errorf("%s", errObj.Message)
+    }
+
+    if result != nil {
+        return vm.push(result)
+    }
+
+    return vm.push(Null)
+}
+
+func (vm *VM) pushClosure(constIndex, numFree int) error {
+    constant := vm.constants[constIndex]
+    fn, ok := constant.(*object.CompiledFunction)
+    if !ok {
+        return fmt.Errorf("not a function: %+v", constant)
+    }
+
+    free := make([]object.Object, numFree)
+    for i := 0; i < numFree; i++ {
+        free[i] = vm.stack[vm.sp - numFree + i]
+    }
+    vm.sp -= numFree
+
+    return vm.push(&object.Closure{Fn: fn, Free: free})
+}
+
 func (vm *VM) executeBinaryOperation(op code.Opcode) error {
     right := vm.pop()
     left := vm.pop()
@@ -248,6 +814,8 @@ func (vm *VM) executeBinaryOperation(op code.Opcode) error {
     switch {
     case left_type == object.INTEGER_OBJ && right_type == object.INTEGER_OBJ:
         return vm.executeBinaryIntegerOperation(op, left, right)
+    case isNumber(left) && isNumber(right): // at least one of them is a float
+        return vm.executeBinaryFloatOperation(op, left, right)
     case left_type == object.STRING_OBJ && right_type == object.STRING_OBJ:
         return vm.executeBinaryStringOperation(op, left, right)
     }
@@ -268,17 +836,89 @@ func (vm *VM) executeBinaryIntegerOperation(op code.Opcode, left, right object.O
     case code.OpMul:
         result = left_val * right_val
     case code.OpDiv:
+        if right_val == 0 {
+            return fmt.Errorf("division by zero")
+        }
         result = left_val / right_val
+    case code.OpMod:
+        if right_val == 0 {
+            return fmt.Errorf("modulo by zero")
+        }
+        result = left_val % right_val
+    case code.OpBitAnd:
+        result = left_val & right_val
+    case code.OpBitOr:
+        result = left_val | right_val
+    case code.OpBitXor:
+        result = left_val ^ right_val
+    case code.OpShiftLeft, code.OpShiftRight:
+        if right_val < 0 {
+            return fmt.Errorf("negative shift count: %d", right_val)
+        }
+        if op == code.OpShiftLeft {
+            result = left_val << right_val
+        } else {
+            result = left_val >> right_val
+        }
     default:
-        return fmt.Errorf("unkown integer operator: %d", op)
+        return unknownOperator(op, left, right)
     }
 
     return vm.push(&object.Integer{Value: result})
 }
 
+// integers are promoted to floats when mixed with them. floats follow IEEE 754, so
+// dividing by zero gives an infinity instead of an error
+func (vm *VM) executeBinaryFloatOperation(op code.Opcode, left, right object.Object) error {
+    left_val, _ := object.ToFloat(left)
+    right_val, _ := object.ToFloat(right)
+    var result float64
+
+    switch op {
+    case code.OpAdd:
+        result = left_val + right_val
+    case code.OpSub:
+        result = left_val - right_val
+    case code.OpMul:
+        result = left_val * right_val
+    case code.OpDiv:
+        result = left_val / right_val
+    case code.OpMod:
+        result = math.Mod(left_val, right_val)
+    default:
+        return unknownOperator(op, left, right)
+    }
+
+    return vm.push(&object.Float{Value: result})
+}
+
+// the operators as they're written in the source, for the errors
+var operators = map[code.Opcode]string{
+    code.OpAdd: "+",
+    code.OpSub: "-",
+    code.OpMul: "*",
+    code.OpDiv: "/",
+    code.OpMod: "%",
+    code.OpBitAnd: "&",
+    code.OpBitOr: "|",
+    code.OpBitXor: "^",
+    code.OpShiftLeft: "<<",
+    code.OpShiftRight: ">>",
+}
+
+// the same error the evaluator gives for an operator the operands don't support
+func unknownOperator(op code.Opcode, left, right object.Object) error {
+    return fmt.Errorf("unknown operator: %s %s %s", left.Type(), operators[op], right.Type())
+}
+
+func isNumber(obj object.Object) bool {
+    _, ok := object.ToFloat(obj)
+    return ok
+}
+
 func (vm *VM) executeBinaryStringOperation(op code.Opcode, left, right object.Object) error {
     if op != code.OpAdd {
-        return fmt.Errorf("unknown string operator: %d", op)
+        return unknownOperator(op, left, right)
     }
 
     left_val := left.(*object.String).Value
@@ -291,10 +931,14 @@ func (vm *VM) executeComparison(op code.Opcode) error {
     right := vm.pop()
     left := vm.pop()
 
-    if left.Type() == object.INTEGER_OBJ || right.Type() == object.INTEGER_OBJ {
+    if left.Type() == object.INTEGER_OBJ && right.Type() == object.INTEGER_OBJ {
         return vm.executeIntegerComparison(op, left, right)
     }
 
+    if isNumber(left) && isNumber(right) {
+        return vm.executeFloatComparison(op, left, right)
+    }
+
     switch op {
     case code.OpEqual:
         return vm.push(nativeBoolToBooleanObject(right == left))
@@ -316,6 +960,26 @@ func (vm *VM) executeIntegerComparison(op code.Opcode, left, right object.Object
         return vm.push(nativeBoolToBooleanObject(left_val != right_val))
     case code.OpLessThan:
         return vm.push(nativeBoolToBooleanObject(left_val < right_val))
+    case code.OpLessEqual:
+        return vm.push(nativeBoolToBooleanObject(left_val <= right_val))
+    default:
+        return fmt.Errorf("unknown operator: %d", op)
+    }
+}
+
+func (vm *VM) executeFloatComparison(op code.Opcode, left, right object.Object) error {
+    left_val, _ := object.ToFloat(left)
+    right_val, _ := object.ToFloat(right)
+
+    switch op {
+    case code.OpEqual:
+        return vm.push(nativeBoolToBooleanObject(left_val == right_val))
+    case code.OpNotEqual:
+        return vm.push(nativeBoolToBooleanObject(left_val != right_val))
+    case code.OpLessThan:
+        return vm.push(nativeBoolToBooleanObject(left_val < right_val))
+    case code.OpLessEqual:
+        return vm.push(nativeBoolToBooleanObject(left_val <= right_val))
     default:
         return fmt.Errorf("unknown operator: %d", op)
     }
@@ -339,20 +1003,30 @@ func (vm *VM) executeBangOperator() error {
 func (vm *VM) executeMinusOperator() error {
     operand := vm.pop()
 
-    if operand.Type() != object.INTEGER_OBJ {
+    switch operand := operand.(type) {
+    case *object.Integer:
+        return vm.push(&object.Integer{Value: -operand.Value})
+    case *object.Float:
+        return vm.push(&object.Float{Value: -operand.Value})
+    default:
         return fmt.Errorf("unsupported type for negation: %s", operand.Type())
     }
-
-    val := operand.(*object.Integer).Value
-    return vm.push(&object.Integer{Value: -val})
 }
 
 func (vm *VM) executeIndexExpression(left, index object.Object) error {
     switch {
     case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
         return vm.executeArrayIndex(left, index)
+    case left.Type() == object.STRING_OBJ && index.Type() == object.INTEGER_OBJ:
+        return vm.executeStringIndex(left, index)
     case left.Type() == object.HASHMAP_OBJ:
         return vm.executeHashIndex(left, index)
+    case left.Type() == object.MODULE_OBJ:
+        value, err := left.(*object.Module).Member(index)
+        if err != nil {
+            return err
+        }
+        return vm.push(value)
     default:
         return fmt.Errorf("index operator not supported: %s", left.Type())
     }
@@ -370,6 +1044,18 @@ func (vm *VM) executeArrayIndex(left, index object.Object) error {
     return vm.push(arrayObj.Elements[i])
 }
 
+// strings are indexed by character, not by byte
+func (vm *VM) executeStringIndex(str, index object.Object) error {
+    chars := []rune(str.(*object.String).Value)
+    i := index.(*object.Integer).Value
+
+    if i < 0 || i >= int64(len(chars)) {
+        return vm.push(Null)
+    }
+
+    return vm.push(&object.String{Value: string(chars[i])})
+}
+
 func (vm *VM) executeHashIndex(hash, index object.Object) error {
     hashMap := hash.(*object.HashMap)
 
@@ -386,6 +1072,33 @@ func (vm *VM) executeHashIndex(hash, index object.Object) error {
     return vm.push(pair.Value)
 }
 
+func (vm *VM) executeSetIndex(left, index, value object.Object) error {
+    switch left := left.(type) {
+    case *object.Array:
+        i, ok := index.(*object.Integer)
+        if !ok {
+            return fmt.Errorf("array index must be INTEGER, got %s", index.Type())
+        }
+
+        if i.Value < 0 || i.Value >= int64(len(left.Elements)) {
+            return fmt.Errorf("index out of range: %d", i.Value)
+        }
+
+        left.Elements[i.Value] = value
+    case *object.HashMap:
+        key, ok := index.(object.Hashable)
+        if !ok {
+            return fmt.Errorf("unusable as hash key: %s", index.Type())
+        }
+
+        left.Pairs[key.HashKey()] = object.HashPair{Key: index, Value: value}
+    default:
+        return fmt.Errorf("index assignment not supported: %s", left.Type())
+    }
+
+    return vm.push(value)
+}
+
 func (vm *VM) buildArray(start , end int) object.Object {
     elements := make([]object.Object, end - start)
 
@@ -438,9 +1151,19 @@ func (vm *VM) currFrame() *Frame {
     return vm.frames[vm.framesIndex - 1]
 }
 
-func (vm *VM) pushFrame(f *Frame) {
-    vm.frames[vm.framesIndex] = f
+func (vm *VM) pushFrame(f *Frame) error {
+    if vm.framesIndex >= vm.maxFrames {
+        return vm.stackOverflow()
+    }
+
+    if vm.framesIndex < len(vm.frames) {
+        vm.frames[vm.framesIndex] = f
+    } else {
+        vm.frames = append(vm.frames, f)
+    }
     vm.framesIndex++
+
+    return nil
 }
 
 func (vm *VM) popFrame() *Frame {
@@ -2,9 +2,11 @@ package vm
 
 import (
 	"fmt"
+    "strings"
     "testing"
 	"monkey/ast"
 	"monkey/compiler"
+	"monkey/internal/testutil"
 	"monkey/lexer"
 	"monkey/object"
 	"monkey/parser"
@@ -31,6 +33,15 @@ func TestIntegerArithmetic(t *testing.T) {
         { "-10 * 5", -50 },
         { "-10 / 5", -2 },
         { "(5 + 10 * 2 + 15 / 3) * 2 + -10", 50 },
+        { "7 % 3", 1 },
+        { "-7 % 3", -1 },
+        { "6 & 3", 2 },
+        { "6 | 3", 7 },
+        { "6 ^ 3", 5 },
+        { "1 << 4", 16 },
+        { "-16 >> 2", -4 },
+        { "~5", -6 },
+        { "1 + 2 << 3", 17 },
     }
 
     runVmTests(t, tests)
@@ -57,6 +68,13 @@ func TestBooleanExpressions(t *testing.T) {
         {"(1 < 2) == false", false},
         {"(1 > 2) == true", false},
         {"(1 > 2) == false", true},
+        {"1 <= 1", true},
+        {"2 <= 1", false},
+        {"1 >= 1", true},
+        {"1 >= 2", false},
+        {"1.5 <= 2", true},
+        {"2 >= 2.5", false},
+        {"4 & 1 == 0", true},
         {"!true", false},
         {"!false", true},
         {"!5", false},
@@ -81,11 +99,161 @@ func TestConditionals(t *testing.T) {
         {"if (1 > 2) { 10 } else { 20 }", 20},
         {"if (1 > 2) { 10 }", Null},
         {"if (false) { 10 }", Null},
+        {"if (false) { 10 } else if (true) { 20 } else { 30 }", 20},
+        {"if (false) { 10 } else if (false) { 20 } else { 30 }", 30},
+        {"if (true) { 10 } else if (true) { 20 } else { 30 }", 10},
+        {"if (1 > 2) { 10 } else if (2 > 3) { 20 } else if (3 > 2) { 30 }", 30},
+        {"if (1 > 2) { 10 } else if (2 > 3) { 20 }", Null},
+        {"let x = 3; if (x == 1) { 10 } else if (x == 2) { 20 } else if (x == 3) { 30 } else { 40 }", 30},
+        {"if (true) { }", Null},
+        {"if (false) { 10 } else if (true) { let a = 1; }", Null},
     }
 
     runVmTests(t, tests)
 }
 
+func TestWhileStatements(t *testing.T) {
+    tests := []vmTestCase{
+        {"while (false) { 10 }; 5", 5},
+        {"let f = fn(n) { while (n > 0) { return n; } }; f(3)", 3},
+        {"let f = fn(n) { while (n > 0) { return n; } }; f(0)", Null},
+        {`
+        let count = [];
+        while (true) {
+        append(count, 1);
+        if (len(count) == 5) { break; }
+        }
+        len(count)
+        `, 5},
+        {`
+        let seen = [];
+        let odd = [];
+        while (len(seen) < 6) {
+        append(seen, 1);
+        if (len(seen) / 2 * 2 == len(seen)) { continue; }
+        append(odd, len(seen));
+        }
+        odd
+        `, []int{1, 3, 5}},
+        {`
+        let f = fn() {
+        let outer = [];
+        let pairs = [];
+        while (len(outer) < 3) {
+        append(outer, 1);
+        let inner = [];
+        while (true) {
+        append(inner, 1);
+        if (len(inner) == 2) { break; }
+        append(pairs, 1);
+        }
+        }
+        len(pairs)
+        };
+        f()
+        `, 3},
+        {`
+        let items = [];
+        while (len(items) < 5000) { append(items, len(items)); }
+        items[4999]
+        `, 4999},
+    }
+
+    runVmTests(t, tests)
+}
+
+func TestForStatements(t *testing.T) {
+    tests := []vmTestCase{
+        {"let out = []; for (x in [1, 2, 3]) { append(out, x * 2); } out", []int{2, 4, 6}},
+        {"let out = []; for (i, x in [7, 8]) { append(out, i); append(out, x); } out", []int{0, 7, 1, 8}},
+        {`let out = []; for (c in "abc") { append(out, c); } out[0] + out[1] + out[2]`, "abc"},
+        {`let out = []; for (i, c in "ab") { append(out, i); } out`, []int{0, 1}},
+        {`let out = []; for (k in {"b": 2, "c": 3, "a": 1}) { append(out, k); } out[0] + out[1] + out[2]`, "abc"},
+        {`let out = []; for (k, v in {3: 30, 1: 10, 2: 20}) { append(out, k); append(out, v); } out`, []int{1, 10, 2, 20, 3, 30}},
+        {"let out = []; for (x in [1, 2, 3, 4]) { if (x == 3) { break; } append(out, x); } out", []int{1, 2}},
+        {"let out = []; for (x in [1, 2, 3, 4]) { if (x == 2) { continue; } append(out, x); } out", []int{1, 3, 4}},
+        {"let f = fn(xs) { for (x in xs) { if (x > 1) { return x; } } }; f([1, 5, 6])", 5},
+        {"let f = fn(xs) { for (x in xs) { x } }; f([1, 2])", Null},
+        {`
+        let f = fn() {
+        let out = [];
+        for (x in [1, 2]) {
+        for (y in [10, 20, 30]) {
+        if (y == 30) { break; }
+        append(out, x * y);
+        }
+        }
+        out
+        };
+        f()
+        `, []int{10, 20, 20, 40}},
+        {"let out = []; for (x in []) { append(out, x); } out", []int{}},
+    }
+
+    runVmTests(t, tests)
+
+    runVmErrorTests(t, []vmErrorTestCase{
+        {"for (x in 5) { x }", "1:1: cannot iterate over INTEGER"},
+    })
+}
+
+func TestAssignExpressions(t *testing.T) {
+    tests := []vmTestCase{
+        {"let a = 1; a = 2; a", 2},
+        {"let a = 1; let b = a = 3; a + b", 6},
+        {"let i = 0; while (i < 10) { i = i + 1; } i", 10},
+        {"let n = 0; let inc = fn() { n = n + 1 }; inc(); inc(); n", 2},
+        {"let f = fn(x) { x = x * 2; x }; f(4)", 8},
+        {"let f = fn() { let sum = 0; for (x in [1, 2, 3]) { sum = sum + x; } sum }; f()", 6},
+        {"let a = [1, 2, 3]; a[1] = 5; a", []int{1, 5, 3}},
+        {"let a = [1, 2, 3]; a[0] = a[2] = 0; a", []int{0, 2, 0}},
+        {`let h = {"a": 1}; h["a"] = 2; h["b"] = 3; h["a"] + h["b"]`, 5},
+        {"let f = fn(f) { f = 1; f }; f(0)", 1},
+        {"let f = fn() { let f = 2; f = 3; f }; f()", 3},
+        {"let len = 1; len = 2; len", 2},
+    }
+
+    runVmTests(t, tests)
+}
+
+func TestIndexAssignmentErrors(t *testing.T) {
+    tests := []vmErrorTestCase{
+        {"let a = [1]; a[1] = 2", "1:15: index out of range: 1"},
+        {`let a = [1]; a["x"] = 2`, "1:15: array index must be INTEGER, got STRING"},
+        {"let h = {}; h[fn(x) { x }] = 1", "1:14: unusable as hash key: CLOSURE"},
+        {"let s = 1; s[0] = 2", "1:13: index assignment not supported: INTEGER"},
+    }
+
+    runVmErrorTests(t, tests)
+}
+
+func TestDestructuringLet(t *testing.T) {
+    tests := []vmTestCase{
+        {"let [a, b] = [1, 2]; a + b", 3},
+        {"let [first, ...rest] = [1, 2, 3]; rest", []int{2, 3}},
+        {"let [a, b, ...rest] = [1, 2]; rest", []int{}},
+        {"let a = 1; let b = 2; let [a, b] = [b, a]; a * 10 + b", 21},
+        {"let xs = [1, 2, 3]; let [x, ...rest] = xs; rest[0] = 9; xs", []int{1, 2, 3}},
+        {"let f = fn(xs) { let [x, y] = xs; x * 10 + y }; f([1, 2])", 12},
+        {`let {name, age} = {"name": "mamad", "age": 30, "x": 1}; name + str(age)`, "mamad30"},
+        {`let f = fn(p) { let {x, y} = p; fn() { x + y } }; f({"x": 1, "y": 2})()`, 3},
+    }
+
+    runVmTests(t, tests)
+}
+
+func TestDestructuringErrors(t *testing.T) {
+    tests := []vmErrorTestCase{
+        {"let [a, b] = [1, 2, 3]", "1:1: wrong number of elements to destructure: want 2, got 3"},
+        {"let [a, b, ...c] = [1]", "1:1: not enough elements to destructure: want at least 2, got 1"},
+        {"let [a] = 5", "1:1: cannot destructure INTEGER as an array"},
+        {`let {a} = [1]`, "1:1: cannot destructure ARRAY as a hash map"},
+        {`let {a, b} = {"a": 1}`, `1:1: key "b" not found in hash map`},
+    }
+
+    runVmErrorTests(t, tests)
+}
+
 func TestGlobalLetStatements(t *testing.T) {
     tests := []vmTestCase{
         {"let one = 1; one", 1},
@@ -202,6 +370,10 @@ func TestFunctionsWithReturnStatement(t *testing.T) {
             `,
             expected: 99,
         },
+        // a return at the top level ends the program with its value
+        {"let a = 1; return a + 1; a = 10; a", 2},
+        {"let i = 0; while (true) { i = i + 1; if (i == 3) { return i; } }", 3},
+        {"let f = fn() { 7 }; return f();", 7},
     }
     runVmTests(t, tests)
 }
@@ -345,41 +517,295 @@ func TestCallingFunctionsWithArgumentsAndBindings(t *testing.T) {
 }
 
 func TestCallingFunctionsWithWrongArguments(t *testing.T) {
-    tests := []vmTestCase{
+    tests := []vmErrorTestCase{
         {
             input:
             `fn() { 1; }(1);`,
-            expected: `wrong number of arguments: want=0, got=1`,
+            expected: `1:12: wrong number of arguments: want=0, got=1`,
         },
         {
             input:
             `fn(a) { a; }();`,
-            expected: `wrong number of arguments: want=1, got=0`,
+            expected: `1:13: wrong number of arguments: want=1, got=0`,
         },
         {
             input:
             `fn(a, b) { a + b; }(1);`,
-            expected: `wrong number of arguments: want=2, got=1`,
+            expected: `1:20: wrong number of arguments: want=2, got=1`,
+        },
+        {
+            input:
+            `fn(a, b = 1) { a; }(1, 2, 3);`,
+            expected: `1:20: wrong number of arguments: want=1 to 2, got=3`,
+        },
+        {
+            input:
+            `fn(a, ...rest) { a; }();`,
+            expected: `1:22: wrong number of arguments: want=at least 1, got=0`,
         },
     }
-    for _, tt := range tests {
-        program := parse(tt.input)
-        comp := compiler.New_Compiler()
-        err := comp.Compile(program)
+    runVmErrorTests(t, tests)
+}
+
+func TestDefaultAndRestParameters(t *testing.T) {
+    tests := []vmTestCase{
+        {"let f = fn(a, b = 10) { a + b }; f(1)", 11},
+        {"let f = fn(a, b = 10) { a + b }; f(1, 2)", 3},
+        {"let f = fn(a, b = a * 2) { b }; f(4)", 8},
+        {"let f = fn(a = b, b = 2) { a }; f()", Null},
+        {"let n = 0; let f = fn(x = n) { x }; n = 7; f()", 7},
+        {"let calls = 0; let f = fn(x = calls = calls + 1) { x }; f(); f(); f(9); calls", 2},
+        {"let f = fn(a = []) { append(a, 1); a }; f(); f()", []int{1}},
+        {"let f = fn(...rest) { rest }; f(1, 2, 3)", []int{1, 2, 3}},
+        {"let f = fn(...rest) { rest }; f()", []int{}},
+        {"let f = fn(a, b = 2, ...rest) { rest }; f(1)", []int{}},
+        {"let f = fn(a, b = 2, ...rest) { a + b + len(rest) }; f(1)", 3},
+        {"let f = fn(a, b = 2, ...rest) { rest }; f(1, 3, 5, 7)", []int{5, 7}},
+        {"let f = fn(a, b = 2, ...rest) { let c = a + b; c }; f(1, 3, 5, 7)", 4},
+        {"let x = 5; let f = fn(a = x + 1) { fn() { a } }; f()()", 6},
+        {"let sum = fn(...xs) { let s = 0; for (x in xs) { s = s + x; } s }; sum(1, 2, 3, 4)", 10},
+    }
+
+    runVmTests(t, tests)
+}
+
+func TestTryCatch(t *testing.T) {
+    tests := []vmTestCase{
+        {"let r = 0; try { r = 1 / 0; } catch (e) { r = e.message; } r", "division by zero"},
+        {"let r = 0; try {\n  r = 1 / 0;\n} catch (e) { r = [e.line, e.column]; } r", []int{2, 9}},
+        {`let r = 0; try { throw "boom"; } catch (e) { r = e; } r`, "boom"},
+        {"let r = 0; try { throw [1, 2]; } catch (e) { r = e; } r", []int{1, 2}},
+        {"let r = 0; try { r = 1; } catch (e) { r = 2; } r", 1},
+        {"let r = []; try { r = append(r, 1); } finally { r = append(r, 2); } r", []int{1, 2}},
+        {"let r = []; try { throw 1; } catch (e) { r = append(r, e); } finally { r = append(r, 2); } r", []int{1, 2}},
+        {"let r = []; let f = fn() { try { return 1; } finally { r = append(r, 2); } }; f(); r", []int{2}},
+        {"let f = fn() { try { return 1; } finally { return 2; } }; f()", 2},
+        {"let r = []; for (x in [1, 2, 3]) { try { if (x == 2) { continue; } if (x == 3) { break; } } finally { r = append(r, x); } } r", []int{1, 2, 3}},
+        {"let r = []; let i = 0; while (i < 3) { i = i + 1; try { try { continue; } finally { r = append(r, i); } } finally { r = append(r, 0); } } r", []int{1, 0, 2, 0, 3, 0}},
+        {"let r = []; try { try { throw 1; } finally { r = append(r, 2); } } catch (e) { r = append(r, e); } r", []int{2, 1}},
+        {"let r = []; try { try { throw 1; } catch (e) { throw e + 1; } finally { r = append(r, 3); } } catch (e) { r = append(r, e); } r", []int{3, 2}},
+        {"let f = fn(x) { 1 / x }; let g = fn() { f(0) }; let r = 0; try { g(); } catch (e) { r = e.message; } r", "division by zero"},
+        {`let r = 0; try { throw {"message": "custom", "code": 7}; } catch (e) { r = e.code; } r`, 7},
+        {"let f = fn(x) { if (x > 0) { throw x; } 0 }; let r = 0; for (x in [0, 3]) { try { r = r + f(x); } catch (e) { r = r + e * 10; } } r", 30},
+        {"let f = fn() { let a = 1; try { let b = [a, a]; throw b; } catch (e) { return len(e) + a; } }; [f(), f()]", []int{3, 3}},
+        {"let f = fn() { try { return fn() { throw 5 }(); } catch (e) { return e; } }; f() + f()", 10},
+    }
+
+    runVmTests(t, tests)
+}
+
+func TestUncaughtExceptions(t *testing.T) {
+    tests := []vmErrorTestCase{
+        {`throw "boom"`, "1:1: uncaught exception: boom"},
+        {"let f = fn() {\n  throw 7;\n}; f()", "2:3: uncaught exception: 7"},
+        {`try { throw "boom"; } finally { 1; }`, "1:7: uncaught exception: boom"},
+        {"try { 1 / 0; } finally { 1; }", "1:9: division by zero"},
+        {`try { 1; } catch (e) { 2; } throw {"message": "custom"}`, "1:29: custom"},
+    }
+
+    runVmErrorTests(t, tests)
+}
+
+func TestMatchExpressions(t *testing.T) {
+    describe := `let describe = fn(x) {
+        match (x) {
+            0 => "zero",
+            -1 => "minus one",
+            2.5 => "two and a half",
+            "hi" => "greeting",
+            true => "yes",
+            [] => "empty",
+            [a] => "one: " + str(a),
+            [a, b] => "pair: " + str(a + b),
+            [a, ...rest] if (len(rest) > 2) => "long",
+            [[a, b], ...rest] => "nested: " + str(a * b),
+            {"type": "point", x, y} => "point: " + str(x + y),
+            {"type": t} => "typed: " + t,
+            {} => "hash",
+            n if (n > 100) => "big",
+            _ => "other",
+        }
+    };`
+
+    tests := []vmTestCase{
+        {describe + "describe(0)", "zero"},
+        {describe + "describe(0.0)", "zero"},
+        {describe + "describe(-1)", "minus one"},
+        {describe + "describe(2.5)", "two and a half"},
+        {describe + `describe("hi")`, "greeting"},
+        {describe + "describe(true)", "yes"},
+        {describe + "describe([])", "empty"},
+        {describe + "describe([7])", "one: 7"},
+        {describe + "describe([3, 4])", "pair: 7"},
+        {describe + "describe([1, 2, 3, 4])", "long"},
+        {describe + "describe([[2, 3], 4, 5])", "nested: 6"},
+        {describe + `describe({"type": "point", "x": 1, "y": 2})`, "point: 3"},
+        {describe + `describe({"type": "point", "x": 1})`, "typed: point"},
+        {describe + `describe({"type": "circle", "r": 1})`, "typed: circle"},
+        {describe + `describe({"r": 1})`, "hash"},
+        {describe + "describe(101)", "big"},
+        {describe + "describe(100)", "other"},
+        {`match ([1, 2, 3]) { [a, b] => "pair", [[a], ...r] => "nested", ["x", ...r] => "x", _ => "other" }`, "other"},
+        {`match (false) { true => "yes", 0 => "zero", "" => "empty", _ => "other" }`, "other"},
+        {"match ([1, 2, 3]) { [first, ...rest] => rest }", []int{2, 3}},
+        {"match ([1, 2, 3]) { [first, ..._] => first }", 1},
+        {"match (5) { x => x * 2 }", 10},
+        {"let x = 1; match (5) { x if (x < 3) => 0, _ => x }", 1},
+        {`match ({1: "a", true: "b"}) { {1: a, true: b} => a + b }`, "ab"},
+        {`match ("5") { 5 => "int", "5" => "string" }`, "string"},
+        {"let f = fn(n) { match (n) { 0 => 1, _ => n * f(n - 1) } }; f(5)", 120},
+        {"let f = fn(xs) { match (xs) { [x, ...r] => fn() { x + len(r) } } }; f([5, 6, 7])()", 7},
+        {"let f = fn(x) { let y = match (x) { [a, b] => a + b, _ => 0 }; match (y) { 3 => y * 10, _ => y } }; f([1, 2])", 30},
+        {"match (match (1) { 1 => [2, 3], _ => [] }) { [a, b] => match (a) { 2 => b, _ => 0 } }", 3},
+    }
+
+    runVmTests(t, tests)
+}
+
+func TestMatchErrors(t *testing.T) {
+    tests := []vmErrorTestCase{
+        {"match (5) { 1 => 2 }", "1:1: no match arm for 5"},
+        {`match ([1, 2]) { [a] => a, {"a": a} => a }`, "1:1: no match arm for [1, 2]"},
+        {"match (5) { x if (x + true) => 1 }", "1:21: unsupported types for binary operation: INTEGER BOOLEAN"},
+    }
+
+    runVmErrorTests(t, tests)
+}
+
+func TestTailCalls(t *testing.T) {
+    tests := []vmTestCase{
+        {"let loop = fn(n, acc) { if (n == 0) { acc } else { loop(n - 1, acc + 1) } }; loop(1000000, 0)", 1000000},
+        {`let loop = fn(n) { if (n == 0) { return "done"; } return loop(n - 1); }; loop(1000000)`, "done"},
+        {"let loop = fn(n) { match (n) { 0 => 0, _ => loop(n - 1) } }; loop(1000000)", 0},
+        {`
+        let fns = {};
+        let even = fn(n) { if (n == 0) { true } else { fns["odd"](n - 1) } };
+        fns["odd"] = fn(n) { if (n == 0) { false } else { even(n - 1) } };
+        fns["odd"](100001)
+        `, true},
+        {"let sum = fn(n, acc = 0, ...extra) { if (n == 0) { acc + len(extra) } else { sum(n - 1, acc + n) } }; sum(100000)", 5000050000},
+        {"let sum = fn(n, acc = 0, ...extra) { if (n == 0) { acc + len(extra) } else { sum(n - 1, acc, 1, 2) } }; sum(3)", 2},
+        {"let make = fn(k) { fn(n) { if (n == 0) { k } else { make(k + 1)(n - 1) } } }; make(0)(100000)", 100000},
+        {"let count = fn(xs, n) { match (xs) { [] => n, [x, ...rest] => count(rest, n + 1) } }; count([1, 2, 3, 4], 0)", 4},
+        {"let f = fn(xs) { len(xs) }; f([1, 2])", 2},
+        {"let f = fn(a, b) { let c = a * b; let g = fn(x) { x + c }; g(a) }; f(2, 3)", 8},
+        {"let r = []; let g = fn() { r = append(r, 1); 5 }; let f = fn() { try { return g(); } finally { r = append(r, 2); } }; f() + len(r)", 7},
+        {`let g = fn(n) { if (n == 0) { throw "deep"; } g(n - 1) }; let r = 0; try { g(100000); } catch (e) { r = e; } r`, "deep"},
+    }
+
+    runVmTests(t, tests)
+}
+
+func TestStackLimits(t *testing.T) {
+    deep := "let f = fn(n) { if (n == 0) { 0 } else { 1 + f(n - 1) } }; f(%d)"
+    catches := "let f = fn(n) { f(n + 1) + 1 }; let r = 0; try { f(0); } catch (e) { r = 1; } r"
+
+    runVmErrorTests(t, []vmErrorTestCase{
+        {fmt.Sprintf(deep, 5000), "1:52: stack overflow at depth 683"},
+    })
+    runVmErrorTestsWithOptions(t, Options{MaxFrames: 100}, []vmErrorTestCase{
+        {fmt.Sprintf(deep, 5000), "1:47: stack overflow at depth 100"},
+        {fmt.Sprintf(deep, 50), ""},
+    })
+    runVmErrorTestsWithOptions(t, Options{MaxStackSize: 50}, []vmErrorTestCase{
+        {fmt.Sprintf(deep, 5000), "1:52: stack overflow at depth 17"},
+    })
+    runVmErrorTestsWithOptions(t, Options{MaxStackSize: 100000, MaxFrames: 10000}, []vmErrorTestCase{
+        {fmt.Sprintf(deep, 5000), ""},
+    })
+    runVmErrorTestsWithOptions(t, Options{MaxFrames: 50}, []vmErrorTestCase{
+        {catches, ""},
+    })
+}
+
+func TestStackStartsSmall(t *testing.T) {
+    program := parse("let f = fn(n) { if (n == 0) { 0 } else { 1 + f(n - 1) } }; f(500)")
+    comp := compiler.New_Compiler()
+    err := comp.Compile(program)
+    if err != nil {
+        t.Fatalf("compiler error: %s", err)
+    }
+
+    vm := New_VM(comp.Bytecode())
+    if len(vm.stack) >= StackSize || cap(vm.frames) >= MaxFrames {
+        t.Fatalf("vm allocated its limits up front: stack=%d, frames=%d", len(vm.stack), cap(vm.frames))
+    }
+
+    err = vm.Run()
+    if err != nil {
+        t.Fatalf("vm error: %s", err)
+    }
+    testExpectedObject(t, 500, vm.LastPopped())
+    if len(vm.stack) > StackSize {
+        t.Errorf("stack grew past its limit: %d", len(vm.stack))
+    }
+}
+
+func TestGlobalStoreIsShared(t *testing.T) {
+    globals := make([]object.Object, 8)
+    symTable := compiler.NewSymTable()
+    constants := []object.Object{}
+
+    for _, input := range []string{"let a = 2;", "a * 3"} {
+        comp := compiler.New_Compiler_With_States(constants, symTable)
+        err := comp.Compile(parse(input))
         if err != nil {
             t.Fatalf("compiler error: %s", err)
         }
-        vm := New_VM(comp.Bytecode())
+        constants = comp.Bytecode().Constants
+
+        vm := New_VM_With_Options(comp.Bytecode(), Options{Globals: globals, MaxFrames: 10})
+        if len(vm.globals) != len(globals) {
+            t.Fatalf("vm made its own globals instead of using the store")
+        }
+
         err = vm.Run()
-        if err == nil {
-            t.Fatalf("expected VM error but resulted in none.")
+        if err != nil {
+            t.Fatalf("vm error: %s", err)
         }
-        if err.Error() != tt.expected {
-            t.Fatalf("wrong VM error: want=%q, got=%q", tt.expected, err)
+        if input == "a * 3" {
+            testExpectedObject(t, 6, vm.LastPopped())
         }
     }
 }
 
+func TestImports(t *testing.T) {
+    dir := testutil.WriteFiles(t, testutil.Modules)
+
+    tests := []vmTestCase{
+        {`let m = import "DIR/lib/math.monkey"; m.square(4) + m.quad(1)`, 20},
+        {`let m = import "DIR/lib/math.monkey"; m.one + m["two"]`, 3},
+        {`(import "DIR/lib/uses.monkey").nine`, 9},
+        {`let a = import "DIR/lib/math.monkey"; let b = import "DIR/lib/uses.monkey"; a.state.count = 5; (import "DIR/lib/math.monkey").state.count`, 5},
+        {`let f = fn() { import "DIR/lib/math.monkey" }; f().two`, 2},
+        {`let x = 1; let m = import "DIR/lib/math.monkey"; let y = 2; x + y + m.one`, 4},
+    }
+
+    for i := range tests {
+        tests[i].input = strings.ReplaceAll(tests[i].input, "DIR", dir)
+    }
+
+    runVmTests(t, tests)
+}
+
+func TestImportErrors(t *testing.T) {
+    dir := testutil.WriteFiles(t, testutil.Modules)
+
+    tests := []vmErrorTestCase{
+        {"let m = import \"DIR/lib/math.monkey\";\nm.secret", `2:2: module DIR/lib/math.monkey has no export "secret"`},
+        {"let m = import \"DIR/lib/math.monkey\";\nm.one = 2", "2:2: index assignment not supported: MODULE"},
+        {`import "DIR/cycle_a.monkey"`, "DIR/cycle_b.monkey:1:1: import cycle: DIR/cycle_a.monkey -> DIR/cycle_b.monkey -> DIR/cycle_a.monkey"},
+        {`import "DIR/missing.monkey"`, "1:1: cannot import DIR/missing.monkey: no such file or directory"},
+    }
+
+    for i := range tests {
+        tests[i].input = strings.ReplaceAll(tests[i].input, "DIR", dir)
+        tests[i].expected = strings.ReplaceAll(tests[i].expected, "DIR", dir)
+    }
+
+    runVmErrorTests(t, tests)
+}
+
 func TestFirstClassFunctions(t *testing.T) {
     tests := []vmTestCase{
         {
@@ -396,6 +822,341 @@ func TestFirstClassFunctions(t *testing.T) {
     runVmTests(t, tests)
 }
 
+func TestBuiltinFunctions(t *testing.T) {
+    tests := []vmTestCase{
+        {`len("")`, 0},
+        {`len("four")`, 4},
+        {`len("hello world")`, 11},
+        {`len([1, 2, 3])`, 3},
+        {`len([])`, 0},
+        {`len({1: 2})`, 1},
+        {`puts("hello", "world!")`, Null},
+        {`append([], 1)`, []int{1}},
+        {`insert([1, 3], 1, 2)`, []int{1, 2, 3}},
+        {`ordered_remove([1, 2, 3], 0)`, []int{2, 3}},
+        {`unordered_remove([1, 2, 3], 0)`, []int{3, 2}},
+        {`let f = fn(arr) { len(arr) }; f([1, 2])`, 2},
+    }
+    runVmTests(t, tests)
+}
+
+func TestInterpolatedStrings(t *testing.T) {
+    tests := []vmTestCase{
+        {`let n = 4; "count: ${n + 1}"`, "count: 5"},
+        {`"${1.5} ${true} ${[1, "a"]} ${"str"}"`, `1.5 true [1, a] str`},
+        {`let name = "monkey"; "hi ${name}, ${"nested ${name}"}"`, "hi monkey, nested monkey"},
+        {`let f = fn(x) { "<${x}>" }; f(1) + f("y")`, "<1><y>"},
+        {`"${if (false) { 1 }}"`, "null"},
+        {`"${1}"`, "1"},
+    }
+
+    runVmTests(t, tests)
+}
+
+func TestUnicodeStrings(t *testing.T) {
+    tests := []vmTestCase{
+        {`len("héllo")`, 5},
+        {`len("سلام دنیا")`, 9},
+        {`"héllo"[1]`, "é"},
+        {`"😀!"[0] + "😀!"[1]`, "😀!"},
+        {`"héllo"[5]`, Null},
+        {`"héllo"[-1]`, Null},
+        {`let out = ""; for (i, c in "aé😀") { out = out + str(i) + c; } out`, "0a1é2😀"},
+        {`let نام = "علی"; "سلام ${نام}"`, "سلام علی"},
+    }
+
+    runVmTests(t, tests)
+}
+
+func TestLogicalExpressions(t *testing.T) {
+    tests := []vmTestCase{
+        {"true && true", true},
+        {"true && false", false},
+        {"false || true", true},
+        {"false || false", false},
+        {"1 && 2", 2},
+        {"0 || 5", 0},
+        {"false && 5", false},
+        {"if (false) { 1 } || 7", 7},
+        {"1 < 2 && 2 < 3", true},
+        {"let hits = []; let f = fn() { append(hits, 1); true }; false && f(); true || f(); len(hits)", 0},
+        {"let hits = []; let f = fn() { append(hits, 1); true }; true && f(); false || f(); len(hits)", 2},
+        {"let f = fn(a, b) { if (a && b) { 1 } else { 2 } }; f(true, 0) + f(false, true)", 3},
+        {"let i = 0; while (i < 10 && i != 4) { i = i + 1; } i", 4},
+    }
+
+    runVmTests(t, tests)
+}
+
+func TestFloatArithmetic(t *testing.T) {
+    tests := []vmTestCase{
+        {"3.5", 3.5},
+        {"-2.5", -2.5},
+        {"1.5 + 1.5", 3.0},
+        {"1 + 0.5", 1.5},
+        {"7 / 2.0", 3.5},
+        {"7 / 2", 3},
+        {"1e3 * 2", 2000.0},
+        {"2 - 0.5", 1.5},
+        {"1 == 1.0", true},
+        {"1.5 != 1.5", false},
+        {"2 < 2.5", true},
+        {"2.5 > 3", false},
+        {"7.5 % 2", 1.5},
+        {"1 / 0.0 > 1e308", true},
+        {`{1: "a"}[1.0]`, "a"},
+        {`{2.5: "b"}[2.5]`, "b"},
+        {"int(3.9)", 3},
+        {`int("42")`, 42},
+        {"float(2)", 2.0},
+        {`float("1.25")`, 1.25},
+        {`str(1.5) + str(2)`, "1.52"},
+    }
+
+    runVmTests(t, tests)
+}
+
+func TestBuiltinFunctionErrors(t *testing.T) {
+    tests := []vmErrorTestCase{
+        {`len(1)`, "1:4: argument to `len` not supported, got INTEGER"},
+        {`len("one", "two")`, "1:4: wrong number of arguments. got=2, want=1"},
+        {`append(1, 1)`, "1:7: first argument to `append` must be ARRAY, got INTEGER"},
+        {`int("x")`, "1:4: could not parse \"x\" as integer"},
+        {`1.5 + true`, "1:5: unsupported types for binary operation: FLOAT BOOLEAN"},
+        {"1 / 0", "1:3: division by zero"},
+        {"let f = fn(x) { 10 % x }; f(0)", "1:20: modulo by zero"},
+        {"1 << -1", "1:3: negative shift count: -1"},
+        {"~true", "1:1: unknown operator: ~BOOLEAN"},
+        {"~1.5", "1:1: unknown operator: ~FLOAT"},
+        {"1.5 & 2", "1:5: unknown operator: FLOAT & INTEGER"},
+        {`"a" - "b"`, "1:5: unknown operator: STRING - STRING"},
+    }
+
+    runVmErrorTests(t, tests)
+}
+
+func TestClosures(t *testing.T) {
+    tests := []vmTestCase{
+        {
+            input: `
+            let newClosure = fn(a) {
+            fn() { a; };
+            };
+            let closure = newClosure(99);
+            closure();
+            `,
+            expected: 99,
+        },
+        {
+            input: `
+            let newAdder = fn(a, b) {
+            fn(c) { a + b + c };
+            };
+            let adder = newAdder(1, 2);
+            adder(8);
+            `,
+            expected: 11,
+        },
+        {
+            input: `
+            let newAdderOuter = fn(a, b) {
+            let c = a + b;
+            fn(d) {
+            let e = d + c;
+            fn(f) { e + f; };
+            };
+            };
+            let newAdderInner = newAdderOuter(1, 2)
+            let adder = newAdderInner(3);
+            adder(8);
+            `,
+            expected: 14,
+        },
+        {
+            input: `
+            let curry = fn(a) { fn(b) { fn(c) { a * 100 + b * 10 + c } } };
+            curry(1)(2)(3);
+            `,
+            expected: 123,
+        },
+        {
+            input: `
+            let newClosure = fn(a, b) {
+            let one = fn() { a; };
+            let two = fn() { b; };
+            fn() { one() + two(); };
+            };
+            let closure = newClosure(9, 90);
+            closure();
+            `,
+            expected: 99,
+        },
+        {
+            input: `
+            let counter = fn(start) {
+            let next = fn(step) { fn() { start + step } };
+            [next(1)(), next(2)(), next(3)()]
+            };
+            counter(10);
+            `,
+            expected: []int{11, 12, 13},
+        },
+    }
+    runVmTests(t, tests)
+}
+
+func TestMutableCaptures(t *testing.T) {
+    tests := []vmTestCase{
+        {"let make = fn() { let c = 0; fn() { c = c + 1; c } }; let f = make(); f(); f()", 2},
+        {"let make = fn() { let c = 0; [fn() { c = c + 1 }, fn() { c }] }; let p = make(); p[0](); p[0](); p[1]()", 2},
+        {"let f = fn() { let x = 1; let g = fn() { x = 5 }; g(); x }; f()", 5},
+        {"let f = fn() { let x = 1; let g = fn() { x }; x = 7; g() }; f()", 7},
+        {"let f = fn(a) { fn() { fn() { a = a + 1; a } } }; let g = f(1)(); g(); g()", 3},
+        {"let make = fn() { let c = 0; fn() { c = c + 1; c } }; let a = make(); let b = make(); a(); a(); b()", 1},
+        {"let make = fn(n) { let c = n; fn() { c } }; let a = make(1); let b = make(2); a() + b()", 3},
+        {"let f = fn() { let fs = []; for (i in [1, 2, 3]) { fs = append(fs, fn() { i }) } fs[0]() }; f()", 3},
+        {"let f = fn() { let fs = []; for (i in [1, 2, 3]) { fs = append(fs, match (i) { n => fn() { n } }) } fs[0]() + fs[2]() }; f()", 4},
+        {"let f = fn(n, acc) { let g = fn() { acc }; if (n == 0) { g() } else { f(n - 1, acc + 1) } }; f(3, 0)", 3},
+    }
+
+    runVmTests(t, tests)
+}
+
+func TestRecursiveFunctions(t *testing.T) {
+    tests := []vmTestCase{
+        {
+            input: `
+            let countDown = fn(x) {
+            if (x == 0) {
+            return 0;
+            } else {
+            countDown(x - 1);
+            }
+            };
+            countDown(1);
+            `,
+            expected: 0,
+        },
+        {
+            input: `
+            let countDown = fn(x) {
+            if (x == 0) {
+            return 0;
+            } else {
+            countDown(x - 1);
+            }
+            };
+            let wrapper = fn() {
+            countDown(1);
+            };
+            wrapper();
+            `,
+            expected: 0,
+        },
+        {
+            input: `
+            let wrapper = fn() {
+            let countDown = fn(x) {
+            if (x == 0) {
+            return 0;
+            } else {
+            countDown(x - 1);
+            }
+            };
+            countDown(1);
+            };
+            wrapper();
+            `,
+            expected: 0,
+        },
+        {
+            input: `
+            let fibonacci = fn(x) {
+            if (x == 0) {
+            return 0;
+            } else {
+            if (x == 1) {
+            return 1;
+            } else {
+            fibonacci(x - 1) + fibonacci(x - 2);
+            }
+            }
+            };
+            fibonacci(15);
+            `,
+            expected: 610,
+        },
+        {
+            input: `
+            let wrapper = fn(n) {
+            let sum = fn(x) {
+            if (x == 0) { 0 } else { x + n + sum(x - 1) }
+            };
+            sum(3);
+            };
+            wrapper(10);
+            `,
+            expected: 36,
+        },
+    }
+    runVmTests(t, tests)
+}
+
+func TestRuntimeErrorStackTrace(t *testing.T) {
+    tests := []vmErrorTestCase{
+        {
+            input: "let a = 1;\na()",
+            expected: "2:2: calling non-function\n\tat <main> (2:2)",
+        },
+        {
+            input: `let inner = fn(x) {
+            x + true
+            };
+            let outer = fn() { inner(1) + 1 };
+            outer();`,
+            expected: "2:15: unsupported types for binary operation: INTEGER BOOLEAN" +
+                "\n\tat inner (2:15)" +
+                "\n\tat outer (4:37)" +
+                "\n\tat <main> (5:18)",
+        },
+        {
+            input: `let f = fn() { let r = fn() { -"a" }(); r };
+            f();`,
+            expected: "1:31: unsupported type for negation: STRING" +
+                "\n\tat <anonymous> (1:31)" +
+                "\n\tat f (1:37)" +
+                "\n\tat <main> (2:14)",
+        },
+        {
+            // a tail call took over outer's frame, so outer isn't in the trace
+            input: `let inner = fn(x) {
+            x + true
+            };
+            let outer = fn() { inner(1) };
+            outer();`,
+            expected: "2:15: unsupported types for binary operation: INTEGER BOOLEAN" +
+                "\n\tat inner (2:15)" +
+                "\n\tat <main> (5:18)",
+        },
+        {
+            input: "let f = fn(n) { if (n == 0) { 0 } else { 1 + f(n - 1) } };\nf(5000);",
+            expected: "1:52: stack overflow at depth 683" +
+                "\n\tat f (1:52)" +
+                "\n\tat f (1:47) ×681" +
+                "\n\tat <main> (2:2)",
+        },
+        {
+            input: "let f = fn(n) { if (n == 0) { -true } else { f(n - 1) + 1 } };\nf(3);",
+            expected: "1:31: unsupported type for negation: BOOLEAN" +
+                "\n\tat f (1:31)" +
+                "\n\tat f (1:47) ×3" +
+                "\n\tat <main> (2:2)",
+        },
+    }
+
+    runVmErrorTests(t, tests)
+}
+
 func runVmTests(t *testing.T, tests []vmTestCase) {
     t.Helper()
 
@@ -419,6 +1180,40 @@ func runVmTests(t *testing.T, tests []vmTestCase) {
     }
 }
 
+type vmErrorTestCase struct {
+    input string
+    expected string // the compiler's or the vm's error, none at all when it's empty
+}
+
+func runVmErrorTests(t *testing.T, tests []vmErrorTestCase) {
+    t.Helper()
+    runVmErrorTestsWithOptions(t, Options{}, tests)
+}
+
+// an expected error of more than one line is the whole stack trace
+func runVmErrorTestsWithOptions(t *testing.T, opts Options, tests []vmErrorTestCase) {
+    t.Helper()
+
+    for _, tt := range tests {
+        comp := compiler.New_Compiler()
+        err := comp.Compile(parse(tt.input))
+        if err == nil {
+            err = New_VM_With_Options(comp.Bytecode(), opts).Run()
+        }
+
+        got := ""
+        if rtErr, ok := err.(*RuntimeError); ok && strings.Contains(tt.expected, "\n") {
+            got = rtErr.StackTrace()
+        } else if err != nil {
+            got = err.Error()
+        }
+
+        if got != tt.expected {
+            t.Errorf("wrong error for %q.\nwant=%q\ngot=%q", tt.input, tt.expected, got)
+        }
+    }
+}
+
 func parse(input string) *ast.Program {
     l := lexer.NewLexer(input)
     p := parser.NewParser(l)
@@ -435,6 +1230,12 @@ func testExpectedObject(t *testing.T, expected interface{}, actual object.Object
             t.Errorf("testIntegerObject failed: %s", err)
             return
         }
+    case float64:
+        err := testFloatObject(expected, actual)
+        if err != nil {
+            t.Errorf("testFloatObject failed: %s", err)
+            return
+        }
     case string:
         err := testStringObject(expected, actual)
         if err != nil {
@@ -447,6 +1248,16 @@ func testExpectedObject(t *testing.T, expected interface{}, actual object.Object
             t.Errorf("testBooleanObject failed: %s", err)
             return
         }
+    case *object.Error:
+        errObj, ok := actual.(*object.Error)
+        if !ok {
+            t.Errorf("object is not Error: %T (%+v)", actual, actual)
+            return
+        }
+
+        if errObj.Message != expected.Message {
+            t.Errorf("wrong error message. expected=%q, got=%q", expected.Message, errObj.Message)
+        }
     case *object.Null:
         if actual != Null {
             t.Errorf("object is not Null: %T (%+v)", actual, actual)
@@ -521,6 +1332,19 @@ func testIntegerObject(expected int64, actual object.Object) error {
     return nil
 }
 
+func testFloatObject(expected float64, actual object.Object) error {
+    result, ok := actual.(*object.Float)
+    if !ok {
+        return fmt.Errorf("object is not Float. got=%T (%+v)", actual, actual)
+    }
+
+    if result.Value != expected {
+        return fmt.Errorf("object has wrong value. got=%g, want=%g", result.Value, expected)
+    }
+
+    return nil
+}
+
 func testBooleanObject(expected bool, actual object.Object) error {
     result, ok := actual.(*object.Boolean)
     if !ok {